@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vadiraj/gopher/internal/store"
+)
+
+// accessTokenPrefix tells personal access tokens apart from JWTs in the
+// Authorization header.
+const accessTokenPrefix = "gsp_"
+
+const (
+	scopePostsRead      = "posts:read"
+	scopePostsWrite     = "posts:write"
+	scopeCommentsWrite  = "comments:write"
+	scopeFeedRead       = "feed:read"
+	scopeUsersRead      = "users:read"
+	scopeUsersFollow    = "users:follow"
+	scopeReactionsWrite = "reactions:write"
+)
+
+type scopesKey string
+
+const scopesCtx scopesKey = "scopes"
+
+type CreateAccessTokenPayload struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,dive,oneof=posts:read posts:write comments:write feed:read users:read users:follow reactions:write"`
+	ExpiresInDays *int     `json:"expires_in_days" validate:"omitempty,gte=1,lte=365"`
+}
+
+type AccessTokenWithSecret struct {
+	*store.AccessToken
+	Token string `json:"token"`
+}
+
+func (app *application) createAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payLoad CreateAccessTokenPayload
+	if err := readJson(w, r, &payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	user := getUserFromCtx(r)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	plainToken := accessTokenPrefix + hex.EncodeToString(secret)
+	token := &store.AccessToken{
+		UserID: user.ID,
+		Name:   payLoad.Name,
+		Token:  hashToken(plainToken),
+		Scopes: slices.Compact(slices.Sorted(slices.Values(payLoad.Scopes))),
+	}
+	if payLoad.ExpiresInDays != nil {
+		expiry := time.Now().Add(time.Hour * 24 * time.Duration(*payLoad.ExpiresInDays))
+		token.Expiry = &expiry
+	}
+	if err := app.store.AccessTokens.Create(r.Context(), token); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorConflict):
+			app.conflictResponse(w, r, fmt.Errorf("a token named %q already exists", payLoad.Name))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.audit(r, "access_token.create", auditTargetAccessToken, strconv.FormatInt(token.ID, 10), map[string]any{
+		"name":   token.Name,
+		"scopes": token.Scopes,
+	})
+	if err := app.jsonResponse(w, http.StatusCreated, AccessTokenWithSecret{AccessToken: token, Token: plainToken}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) listAccessTokensHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	tokens, err := app.store.AccessTokens.GetByUser(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) revokeAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	tokenID, err := strconv.ParseInt(chi.URLParam(r, "tokenId"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	user := getUserFromCtx(r)
+	if err := app.store.AccessTokens.Revoke(r.Context(), user.ID, tokenID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.audit(r, "access_token.revoke", auditTargetAccessToken, strconv.FormatInt(tokenID, 10), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authenticateAccessToken resolves a personal access token to its owner and
+// the scopes it was granted.
+func (app *application) authenticateAccessToken(ctx context.Context, plainToken string) (*store.User, []string, error) {
+	token, err := app.store.AccessTokens.GetByToken(ctx, hashToken(plainToken))
+	if err != nil {
+		if errors.Is(err, store.ErrorNotFound) {
+			return nil, nil, fmt.Errorf("invalid access token")
+		}
+		return nil, nil, err
+	}
+	user, err := app.getUser(ctx, token.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := app.store.AccessTokens.Touch(ctx, token.ID); err != nil {
+		app.logger.Warnw("could not record access token use", "token", token.ID, "error", err)
+	}
+	return user, token.Scopes, nil
+}
+
+// RequireScope lets personal access tokens through only when they carry
+// scope. Requests authenticated with a JWT act with the user's full rights.
+func (app *application) RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scopes, isAccessToken := getScopesFromCtx(r)
+			if isAccessToken && !slices.Contains(scopes, scope) {
+				app.insufficientScopeResponse(w, r, scope)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireUserSession keeps personal access tokens away from account
+// management endpoints, so a leaked token cannot mint more tokens.
+func (app *application) RequireUserSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, isAccessToken := getScopesFromCtx(r); isAccessToken {
+			app.forbiddenResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func getScopesFromCtx(r *http.Request) ([]string, bool) {
+	scopes, ok := r.Context().Value(scopesCtx).([]string)
+	return scopes, ok
+}
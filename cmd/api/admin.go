@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vadiraj/gopher/internal/store"
+)
+
+type targetUserKey string
+
+const targetUserCtx targetUserKey = "targetUser"
+
+type breakGlassKey string
+
+const breakGlassCtx breakGlassKey = "breakGlass"
+
+type AssignRolePayload struct {
+	Role string `json:"role" validate:"required,max=255"`
+}
+
+type RoleTwoFactorPayload struct {
+	Required *bool `json:"required" validate:"required"`
+}
+
+// AdminAuthMiddleware guards the admin API. Users need the users.manage
+// permission. When ADMIN_BASIC_AUTH_ENABLED is set the basic auth
+// credentials are accepted too, as break-glass access for when no admin can
+// sign in.
+func (app *application) AdminAuthMiddleware(next http.Handler) http.Handler {
+	breakGlass := app.BasicAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.logger.Warnw("break-glass admin access", "method", r.Method, "path", r.URL.Path, "ip", r.RemoteAddr)
+		ctx := context.WithValue(r.Context(), breakGlassCtx, true)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}))
+	session := app.AuthTokenMiddleware(app.RequireUserSession(app.RequirePermission(store.PermissionUsersManage)(next)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.config.auth.basic.adminEnabled && strings.HasPrefix(r.Header.Get("Authorization"), "Basic ") {
+			breakGlass.ServeHTTP(w, r)
+			return
+		}
+		session.ServeHTTP(w, r)
+	})
+}
+
+func isBreakGlass(r *http.Request) bool {
+	breakGlass, _ := r.Context().Value(breakGlassCtx).(bool)
+	return breakGlass
+}
+
+func (app *application) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	uq := store.PaginatedUserQuery{
+		Limit:  20,
+		Offset: 0,
+	}
+	uq, err := uq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(uq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	users, err := app.store.Users.List(r.Context(), uq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, users); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) adminGetUserHandler(w http.ResponseWriter, r *http.Request) {
+	if err := app.jsonResponse(w, http.StatusOK, getTargetUserFromCtx(r)); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) assignRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var payLoad AssignRolePayload
+	if err := readJson(w, r, &payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	ctx := r.Context()
+	target := getTargetUserFromCtx(r)
+	role, err := app.store.Roles.GetByName(ctx, payLoad.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.badRequestError(w, r, fmt.Errorf("unknown role %q", payLoad.Role))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := app.store.Users.SetRole(ctx, target.ID, role.Id); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.invalidateCachedUser(ctx, target.ID)
+	app.audit(r, "user.role.assign", auditTargetUser, strconv.FormatInt(target.ID, 10), map[string]change{
+		"role": {From: target.Role.Name, To: role.Name},
+	})
+	target.Role = *role
+	target.RoleID = role.Id
+	if err := app.jsonResponse(w, http.StatusOK, target); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// setRoleTwoFactorHandler decides whether users of a role have to enroll in
+// two-factor authentication before the role's permissions apply. Cached
+// users pick the change up once their cache entry expires.
+func (app *application) setRoleTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var payLoad RoleTwoFactorPayload
+	if err := readJson(w, r, &payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	ctx := r.Context()
+	role, err := app.store.Roles.GetByName(ctx, chi.URLParam(r, "role"))
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := app.store.Roles.SetRequires2FA(ctx, role.Name, *payLoad.Required); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.audit(r, "role.two_factor.set", auditTargetRole, role.Name, map[string]change{
+		"requires_2fa": {From: role.Requires2FA, To: *payLoad.Required},
+	})
+	role.Requires2FA = *payLoad.Required
+	if err := app.jsonResponse(w, http.StatusOK, role); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) deactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.setUserActive(w, r, false)
+}
+
+func (app *application) reactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.setUserActive(w, r, true)
+}
+
+func (app *application) setUserActive(w http.ResponseWriter, r *http.Request, active bool) {
+	ctx := r.Context()
+	target := getTargetUserFromCtx(r)
+	if user := getUserFromCtx(r); !active && user != nil && user.ID == target.ID {
+		app.badRequestError(w, r, fmt.Errorf("admins cannot deactivate themselves"))
+		return
+	}
+	sessionIDs, err := app.store.Users.SetActive(ctx, target.ID, active)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := app.revokeSessionTokens(ctx, target.ID, sessionIDs); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.invalidateCachedUser(ctx, target.ID)
+	action := "user.deactivate"
+	if active {
+		action = "user.reactivate"
+	}
+	app.audit(r, action, auditTargetUser, strconv.FormatInt(target.ID, 10), map[string]change{
+		"is_active": {From: target.IsActive, To: active},
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) forcePasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	target := getTargetUserFromCtx(r)
+	if !target.IsActive {
+		app.badRequestError(w, r, fmt.Errorf("user is not active"))
+		return
+	}
+	if err := app.sendPasswordReset(r.Context(), target); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.audit(r, "user.password_reset.force", auditTargetUser, strconv.FormatInt(target.ID, 10), nil)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (app *application) targetUserContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "userId"), 10, 64)
+		if err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+		ctx := r.Context()
+		user, err := app.store.Users.GetByIdAny(ctx, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrorNotFound):
+				app.notFoundError(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+		ctx = context.WithValue(ctx, targetUserCtx, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getTargetUserFromCtx(r *http.Request) *store.User {
+	user, _ := r.Context().Value(targetUserCtx).(*store.User)
+	return user
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -15,7 +16,10 @@ import (
 	httpSwagger "github.com/swaggo/http-swagger"
 	"github.com/vadiraj/gopher/docs" //generate swagger doc
 	"github.com/vadiraj/gopher/internal/auth"
+	"github.com/vadiraj/gopher/internal/hashing"
 	"github.com/vadiraj/gopher/internal/mailer"
+	"github.com/vadiraj/gopher/internal/passwords"
+	"github.com/vadiraj/gopher/internal/ratelimiter"
 	"github.com/vadiraj/gopher/internal/store"
 	"github.com/vadiraj/gopher/internal/store/cache"
 	"go.uber.org/zap"
@@ -28,13 +32,45 @@ type application struct {
 	mailer        mailer.Client
 	authenticator auth.Authenticator
 	cacheStorage  cache.Storage
+	//accountLockout and ipLockout throttle failed logins
+	accountLockout ratelimiter.Lockout
+	ipLockout      ratelimiter.Lockout
+	//oidcProviders are the identity providers users can sign in with, by name
+	oidcProviders map[string]*auth.OIDCProvider
+	//activationLimiter throttles activation email resends per address
+	activationLimiter ratelimiter.Limiter
+	//lastSeen batches session activity between flushes
+	lastSeen *lastSeenTracker
+	//magicLinkEmailLimiter and magicLinkIPLimiter throttle sign in link emails
+	magicLinkEmailLimiter ratelimiter.Limiter
+	magicLinkIPLimiter    ratelimiter.Limiter
+	//passwordPolicy vets new passwords
+	passwordPolicy *passwords.Policy
+	//passwordHasher hashes and verifies passwords, the store shares it
+	passwordHasher hashing.Hasher
+	//dummyPasswordHash is verified against for unknown emails, see
+	//createTokenHandler
+	dummyPasswordHash string
 }
 
 type mailConfig struct {
-	sendGrid  sendGridConfig
-	exp       time.Duration
-	fromEmail string
-	mailTrap  mailTrapConfig
+	sendGrid    sendGridConfig
+	exp         time.Duration
+	resetExp    time.Duration
+	fromEmail   string
+	mailTrap    mailTrapConfig
+	invitations invitationConfig
+	//emailChangeExp is how long an email change waits for confirmation
+	emailChangeExp time.Duration
+}
+
+// invitationConfig controls activation resends and how long never-activated
+// accounts are kept once their invitation has expired.
+type invitationConfig struct {
+	resendLimit     int
+	resendWindow    time.Duration
+	grace           time.Duration
+	cleanupInterval time.Duration
 }
 
 type sendGridConfig struct {
@@ -47,19 +83,89 @@ type mailTrapConfig struct {
 }
 
 type tokenConfig struct {
-	secret string
-	exp    time.Duration
-	iss    string
+	secret     string
+	exp        time.Duration
+	refreshExp time.Duration
+	iss        string
+	keys       tokenKeysConfig
+}
+
+// tokenKeysConfig switches token signing from the shared secret to an
+// asymmetric key. verify lists retired keys as "kid=path" pairs separated
+// by commas so tokens they signed keep validating during a rotation.
+type tokenKeysConfig struct {
+	alg            string
+	signingKeyID   string
+	signingKeyFile string
+	verify         string
 }
 
 type authConfig struct {
-	basic basicConfig
-	token tokenConfig
+	basic     basicConfig
+	token     tokenConfig
+	login     loginConfig
+	oidc      []auth.OIDCConfig
+	sessions  sessionConfig
+	cookie    cookieConfig
+	password  hashing.Argon2idParams
+	policy    passwordPolicyConfig
+	magicLink magicLinkConfig
+	invites   inviteCodeConfig
+}
+
+// inviteCodeConfig gates registration behind invite codes when required is
+// set. userQuota is how many codes each user can create, exp how long new
+// codes stay valid.
+type inviteCodeConfig struct {
+	required  bool
+	userQuota int
+	exp       time.Duration
+}
+
+// magicLinkConfig controls passwordless sign in links. Issuing is limited
+// per email and per ip over the same window.
+type magicLinkConfig struct {
+	exp        time.Duration
+	emailLimit int
+	ipLimit    int
+	window     time.Duration
+}
+
+type passwordPolicyConfig struct {
+	minLength int
+	minScore  int
+	//breachedDir holds the breached password range files, empty disables the check
+	breachedDir string
+}
+
+type cookieConfig struct {
+	domain   string
+	sameSite http.SameSite
+}
+
+type corsConfig struct {
+	allowedOrigins []string
+	maxAge         time.Duration
+}
+
+type sessionConfig struct {
+	//lastSeenFlush is how often session activity is written to the database
+	lastSeenFlush time.Duration
+}
+
+type loginConfig struct {
+	maxAttempts   int
+	ipMaxAttempts int
+	window        time.Duration
+	baseLockout   time.Duration
+	maxLockout    time.Duration
 }
 
 type basicConfig struct {
 	user string
 	pass string
+	//adminEnabled accepts the basic credentials on the admin API
+	adminEnabled bool
 }
 
 type config struct {
@@ -71,6 +177,22 @@ type config struct {
 	frontendUrl string
 	auth        authConfig
 	redisCfg    redisConfig
+	cors        corsConfig
+	trash       trashConfig
+	//publishInterval is how often scheduled posts are checked for publishing
+	publishInterval time.Duration
+	//reactions are the kinds users can react to posts and comments with
+	reactions []string
+	//trustProxyHeaders takes the client address from forwarding headers. Only
+	//turn it on behind a proxy that overwrites them, anyone can send them
+	trustProxyHeaders bool
+}
+
+// trashConfig controls how long deleted posts and comments can be restored
+// before the purge job removes them.
+type trashConfig struct {
+	retention     time.Duration
+	purgeInterval time.Duration
 }
 
 type redisConfig struct {
@@ -90,42 +212,127 @@ type dbConfig struct {
 func (app *application) mount() http.Handler {
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	if app.config.trustProxyHeaders {
+		r.Use(middleware.RealIP)
+	}
 	r.Use(middleware.Recoverer)
+	r.Use(app.CORSMiddleware)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Timeout(60 * time.Second))
 	r.Route("/v1", func(r chi.Router) {
 		r.Get("/health", app.healthCheckHandler)
+		r.Get("/.well-known/jwks.json", app.jwksHandler)
 		docsUrl := fmt.Sprintf("%s/swagger/doc.json", app.config.addr)
 		r.Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL(docsUrl)))
 		r.Route("/posts", func(r chi.Router) {
 			r.Use(app.AuthTokenMiddleware)
-			r.Post("/", app.createPostHandler)
+			r.With(app.RequireScope(scopePostsWrite)).Post("/", app.createPostHandler)
+			r.With(app.RequireScope(scopePostsRead)).Get("/trash", app.listTrashHandler)
+			r.With(app.deletedPostContextMiddleware, app.RequireScope(scopePostsWrite)).Put("/{postId}/restore", app.CheckPostOwnership(store.PermissionPostsDeleteAny, app.restorePostHandler))
 			r.Route("/{postId}", func(r chi.Router) {
 				r.Use(app.postsContextMiddleware)
-				r.Get("/", app.getPostHandler)
-				r.Patch("/", app.CheckPostOwnership("moderator", app.updatePostHandler))
-				r.Delete("/", app.CheckPostOwnership("admin", app.deletePostHandler))
-				r.Post("/comment", app.addCommentHandler)
+				r.With(app.RequireScope(scopePostsRead)).Get("/", app.getPostHandler)
+				r.With(app.RequireScope(scopePostsWrite)).Patch("/", app.CheckPostOwnership(store.PermissionPostsUpdateAny, app.updatePostHandler))
+				r.With(app.RequireScope(scopePostsWrite)).Delete("/", app.CheckPostOwnership(store.PermissionPostsDeleteAny, app.deletePostHandler))
+				r.With(app.RequireScope(scopePostsRead)).Get("/comments", app.listCommentsHandler)
+				r.With(app.RequireScope(scopeCommentsWrite)).Post("/comment", app.addCommentHandler)
+				r.Route("/reactions", app.reactionRoutes(store.ReactionTargetPost))
+				r.With(app.deletedCommentContextMiddleware, app.RequireScope(scopeCommentsWrite)).Put("/comments/{commentId}/restore", app.CheckCommentOwnership(store.PermissionCommentsDelete, app.restoreCommentHandler))
+				r.Route("/comments/{commentId}", func(r chi.Router) {
+					r.Use(app.commentsContextMiddleware)
+					r.With(app.RequireScope(scopeCommentsWrite)).Patch("/", app.updateCommentHandler)
+					r.With(app.RequireScope(scopeCommentsWrite)).Delete("/", app.CheckCommentOwnership(store.PermissionCommentsDelete, app.deleteCommentHandler))
+					r.Route("/reactions", app.reactionRoutes(store.ReactionTargetComment))
+				})
+				r.Route("/revisions", func(r chi.Router) {
+					r.With(app.RequireScope(scopePostsRead)).Get("/", app.CheckPostOwnership(store.PermissionPostsRevisions, app.listPostRevisionsHandler))
+					r.With(app.RequireScope(scopePostsRead)).Get("/{version}", app.CheckPostOwnership(store.PermissionPostsRevisions, app.getPostRevisionHandler))
+					r.With(app.RequireScope(scopePostsWrite)).Post("/{version}/restore", app.CheckPostOwnership(store.PermissionPostsRestore, app.restorePostRevisionHandler))
+				})
 			})
 		})
 		r.Route("/users", func(r chi.Router) {
 			r.Put("/activate/{token}", app.activateUserHandler)
+			r.Post("/activation/resend", app.resendActivationHandler)
+			r.Put("/email/confirm/{token}", app.confirmEmailChangeHandler)
+			r.Put("/email/cancel/{token}", app.cancelEmailChangeHandler)
+			r.Route("/me", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.RequireUserSession)
+				r.Patch("/email", app.changeEmailHandler)
+				r.Put("/password", app.changePasswordHandler)
+				r.Route("/invites", func(r chi.Router) {
+					r.Get("/", app.listInviteCodesHandler)
+					r.Post("/", app.createInviteCodeHandler)
+				})
+				r.Route("/2fa", func(r chi.Router) {
+					r.Post("/", app.enrollTwoFactorHandler)
+					r.Post("/confirm", app.confirmTwoFactorHandler)
+					r.Delete("/", app.disableTwoFactorHandler)
+				})
+				r.Route("/sessions", func(r chi.Router) {
+					r.Get("/", app.listSessionsHandler)
+					r.Delete("/{sessionId}", app.revokeSessionHandler)
+				})
+				r.Route("/tokens", func(r chi.Router) {
+					r.Get("/", app.listAccessTokensHandler)
+					r.Post("/", app.createAccessTokenHandler)
+					r.Delete("/{tokenId}", app.revokeAccessTokenHandler)
+				})
+			})
 			r.Route("/{userId}", func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware)
-				r.Get("/", app.getUserHandler)
-				r.Put("/follow", app.followUserHandler)
-				r.Put("/unfollow", app.unfollowUserHandler)
+				r.With(app.RequireScope(scopeUsersRead)).Get("/", app.getUserHandler)
+				r.With(app.RequireScope(scopeUsersFollow)).Put("/follow", app.followUserHandler)
+				r.With(app.RequireScope(scopeUsersFollow)).Put("/unfollow", app.unfollowUserHandler)
 			})
 			r.Group(func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware)
-				r.Get("/feed", app.getUserFeedHandler)
+				r.With(app.RequireScope(scopeFeedRead)).Get("/feed", app.getUserFeedHandler)
+			})
+		})
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(app.AdminAuthMiddleware)
+			r.With(app.RequirePermission(store.PermissionAuditRead)).Get("/audit", app.listAuditLogsHandler)
+			r.Post("/invites", app.mintInviteCodesHandler)
+			r.With(app.RequirePermission(store.PermissionPostsDeleteAny)).Get("/trash", app.adminListTrashHandler)
+			r.With(app.RequirePermission(store.PermissionUsersManage)).Put("/roles/{role}/two-factor", app.setRoleTwoFactorHandler)
+			r.Route("/waitlist", func(r chi.Router) {
+				r.Get("/", app.listWaitlistHandler)
+				r.Post("/invite", app.inviteWaitlistHandler)
+			})
+			r.Route("/users", func(r chi.Router) {
+				r.Get("/", app.listUsersHandler)
+				r.Route("/{userId}", func(r chi.Router) {
+					r.Use(app.targetUserContextMiddleware)
+					r.Get("/", app.adminGetUserHandler)
+					r.Put("/role", app.assignRoleHandler)
+					r.With(app.RequirePermission(store.PermissionUsersBan)).Post("/deactivate", app.deactivateUserHandler)
+					r.With(app.RequirePermission(store.PermissionUsersBan)).Post("/reactivate", app.reactivateUserHandler)
+					r.Post("/password-reset", app.forcePasswordResetHandler)
+				})
 			})
 		})
 		//Public routes
+		r.Post("/waitlist", app.joinWaitlistHandler)
 		r.Route("/authentication", func(r chi.Router) {
 			r.Post("/user", app.registerUserHandler)
 			r.Post("/token", app.createTokenHandler)
+			r.Post("/token/2fa", app.twoFactorTokenHandler)
+			r.Post("/refresh", app.refreshTokenHandler)
+			r.With(app.AuthTokenMiddleware, app.RequireUserSession).Post("/logout", app.logoutHandler)
+			r.Route("/password", func(r chi.Router) {
+				r.Post("/forgot", app.forgotPasswordHandler)
+				r.Post("/reset", app.resetPasswordHandler)
+			})
+			r.Route("/magic-link", func(r chi.Router) {
+				r.Post("/", app.magicLinkHandler)
+				r.Post("/exchange", app.magicLinkExchangeHandler)
+			})
+			r.Route("/oidc/{provider}", func(r chi.Router) {
+				r.Get("/", app.oidcLoginHandler)
+				r.Get("/callback", app.oidcCallbackHandler)
+			})
 		})
 	})
 
@@ -143,6 +350,10 @@ func (app *application) run(mux http.Handler) error {
 		ReadTimeout:  time.Second * 10,
 		IdleTimeout:  time.Minute,
 	}
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	var jobs sync.WaitGroup
+	app.startJobs(jobsCtx, &jobs)
 	shutdown := make(chan error)
 	go func() {
 		quit := make(chan os.Signal, 1)
@@ -151,7 +362,10 @@ func (app *application) run(mux http.Handler) error {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 		app.logger.Info("signal caught: ", s.String())
-		shutdown <- srv.Shutdown(ctx)
+		err := srv.Shutdown(ctx)
+		stopJobs()
+		jobs.Wait()
+		shutdown <- err
 	}()
 	app.logger.Infow("server has started at", app.config.addr, "env: ", app.config.env)
 	err := srv.ListenAndServe()
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/vadiraj/gopher/internal/store"
+)
+
+const (
+	auditTargetUser        = "user"
+	auditTargetPost        = "post"
+	auditTargetAccessToken = "access_token"
+	auditTargetSession     = "session"
+	auditTargetComment     = "comment"
+	auditTargetRole        = "role"
+)
+
+type AuditLogPage struct {
+	Entries    []store.AuditLog `json:"entries"`
+	NextCursor *int64           `json:"next_cursor"`
+}
+
+// audit records an action taken by the authenticated user. diff is encoded
+// as JSON when given. Failing to write the record is logged but does not
+// fail the request, the action itself has already happened.
+func (app *application) audit(r *http.Request, action, targetType, targetID string, diff any) {
+	app.auditAs(r, getUserFromCtx(r), action, targetType, targetID, diff)
+}
+
+// auditAs is audit for requests where the actor is not the authenticated
+// user yet, such as a login.
+func (app *application) auditAs(r *http.Request, actor *store.User, action, targetType, targetID string, diff any) {
+	entry := &store.AuditLog{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		RequestID:  middleware.GetReqID(r.Context()),
+		IP:         clientIP(r),
+	}
+	if actor != nil {
+		entry.ActorID = &actor.ID
+	}
+	if diff != nil {
+		encoded, err := json.Marshal(diff)
+		if err != nil {
+			app.logger.Errorw("could not encode audit diff", "action", action, "error", err)
+		} else {
+			entry.Diff = encoded
+		}
+	}
+	if err := app.store.AuditLogs.Create(r.Context(), entry); err != nil {
+		app.logger.Errorw("could not write audit log", "action", action, "target", targetID, "error", err)
+	}
+}
+
+// change is the diff of a single field.
+type change struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+func (app *application) listAuditLogsHandler(w http.ResponseWriter, r *http.Request) {
+	aq := store.AuditLogQuery{
+		Limit: 50,
+	}
+	aq, err := aq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(aq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	entries, err := app.store.AuditLogs.List(r.Context(), aq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	page := AuditLogPage{Entries: entries}
+	if len(entries) == aq.Limit {
+		page.NextCursor = &entries[len(entries)-1].ID
+	}
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
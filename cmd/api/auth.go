@@ -1,22 +1,28 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"github.com/vadiraj/gopher/internal/mailer"
 	"github.com/vadiraj/gopher/internal/store"
 )
 
 type RegisterUserPayload struct {
 	Username string `json:"username" validate:"required,max=100"`
 	Email    string `json:"email" validate:"required,email,max=225"`
-	Password string `json:"password" validate:"required,min=3,max=72"`
+	//the length and strength rules live in the password policy
+	Password string `json:"password" validate:"required,max=256"`
+	//InviteCode is only read while registration is invite only
+	InviteCode string `json:"invite_code" validate:"max=32"`
 }
 
 type UserWithToken struct {
@@ -26,7 +32,24 @@ type UserWithToken struct {
 
 type CreateUserTokenPayload struct {
 	Email    string `json:"email" validate:"required,email,max=155"`
-	Password string `json:"password" validate:"required,min=3,max=72"`
+	Password string `json:"password" validate:"required,min=3,max=256"`
+}
+
+// RefreshTokenPayload is optional in cookie mode, where the refresh token
+// comes from its cookie.
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"max=100"`
+}
+
+type LogoutPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"max=100"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
 }
 
 func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -39,23 +62,35 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		app.badRequestError(w, r, err)
 		return
 	}
+	if app.config.auth.invites.required && payLoad.InviteCode == "" {
+		app.failedValidationResponse(w, r, map[string][]string{"invite_code": {"is required"}})
+		return
+	}
+	if !app.checkPasswordPolicy(w, r, "password", payLoad.Password, payLoad.Username, payLoad.Email) {
+		return
+	}
 	user := &store.User{
 		UserName: payLoad.Username,
 		Email:    payLoad.Email,
 	}
 	//hash the user password
-	if err := user.Password.Set(payLoad.Password); err != nil {
+	if err := user.Password.Set(app.passwordHasher, payLoad.Password); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 	//store the user
 	ctx := r.Context()
 	plainToken := uuid.New().String()
-	hash := sha256.Sum256([]byte(plainToken))
-	hashToken := hex.EncodeToString(hash[:])
-	err := app.store.Users.CreateAndInvite(ctx, user, hashToken, app.config.mail.exp)
+	var err error
+	if app.config.auth.invites.required {
+		err = app.store.Users.CreateWithInviteCode(ctx, user, payLoad.InviteCode, hashToken(plainToken), app.config.mail.exp)
+	} else {
+		err = app.store.Users.CreateAndInvite(ctx, user, hashToken(plainToken), app.config.mail.exp)
+	}
 	if err != nil {
 		switch err {
+		case store.ErrorInviteCodeInvalid:
+			app.failedValidationResponse(w, r, map[string][]string{"invite_code": {err.Error()}})
 		case store.ErrorDuplicateEmail:
 			app.badRequestError(w, r, err)
 		case store.ErrorDuplicateUsername:
@@ -70,24 +105,10 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		User:  user,
 		Token: plainToken,
 	}
-	isProdEnv := app.config.env == "production"
-	activationUrl := fmt.Sprintf("%s/confirm/%s", app.config.frontendUrl, plainToken)
-
-	vars := struct {
-		Username      string
-		ActivationURL string
-	}{
-		Username:      user.UserName,
-		ActivationURL: activationUrl,
-	}
-	_, err = app.mailer.Send(mailer.UserWelcomeTemplate, user.UserName, user.Email, vars, !isProdEnv)
-	if err != nil {
+	//a failed email no longer removes the user, the activation link can be
+	//requested again through /users/activation/resend
+	if err := app.sendActivationEmail(user, plainToken); err != nil {
 		app.logger.Errorw("error sending the welcome email", "error", err)
-		//rollback user creation if email fails (SAGA pattern)
-		if err := app.store.Users.Delete(ctx, user.ID); err != nil {
-			app.logger.Errorw("error deleting user", "err", err)
-		}
-		return
 	}
 	if err := app.jsonResponse(w, http.StatusCreated, userWithToken); err != nil {
 		app.internalServerError(w, r, err)
@@ -106,38 +127,256 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 		app.badRequestError(w, r, err)
 		return
 	}
+	ctx := r.Context()
+	ip := clientIP(r)
+	locked, err := app.loginLockedFor(ctx, payLoad.Email, ip)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if locked > 0 {
+		app.rateLimitExceededResponse(w, r, locked)
+		return
+	}
 	//fetch the user (check if the user exists) from the payload
-	user, err := app.store.Users.GetByEmail(r.Context(), payLoad.Email)
+	user, err := app.store.Users.GetByEmail(ctx, payLoad.Email)
 	if err != nil {
 		switch err {
 		case store.ErrorNotFound:
-			app.unAuthorizedBasicErrorResponse(w, r, err)
+			//unknown emails take as long to answer and count against the
+			//limits like wrong passwords do, so they cannot be told apart
+			app.passwordHasher.Verify(payLoad.Password, app.dummyPasswordHash)
+			app.loginFailed(w, r, nil, payLoad.Email, ip)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	needsRehash, err := user.Password.Verify(app.passwordHasher, payLoad.Password)
+	if err != nil {
+		app.loginFailed(w, r, user, payLoad.Email, ip)
+		return
+	}
+	if err := app.accountLockout.Reset(ctx, loginAccountKey(payLoad.Email)); err != nil {
+		app.logger.Warnw("could not reset failed login attempts", "error", err)
+	}
+	if needsRehash {
+		app.rehashPassword(ctx, user, payLoad.Password)
+	}
+	app.completeLogin(w, r, user)
+}
+
+// completeLogin runs once the first factor has been verified. Users with
+// two-factor authentication get a challenge to answer instead of tokens.
+func (app *application) completeLogin(w http.ResponseWriter, r *http.Request, user *store.User) {
+	ctx := r.Context()
+	if user.TwoFactorEnabled {
+		challenge, err := app.createTwoFactorChallenge(ctx, user)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if err := app.jsonResponse(w, http.StatusOK, challenge); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	tokens, err := app.issueTokens(r, user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.auditAs(r, user, "token.issue", auditTargetUser, strconv.FormatInt(user.ID, 10), nil)
+	app.writeTokens(w, r, tokens)
+}
+
+func (app *application) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payLoad RefreshTokenPayload
+	if err := readJson(w, r, &payLoad); err != nil && !errors.Is(err, io.EOF) {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if payLoad.RefreshToken == "" {
+		cookie, err := r.Cookie(refreshCookieName)
+		if err != nil {
+			app.badRequestError(w, r, fmt.Errorf("refresh_token is required"))
 			return
+		}
+		if !validCSRF(r) {
+			app.invalidCSRFTokenResponse(w, r)
+			return
+		}
+		payLoad.RefreshToken = cookie.Value
+		r = withCookieMode(r)
+	}
+	ctx := r.Context()
+	plainToken := uuid.New().String()
+	refreshToken := &store.RefreshToken{
+		Token:  hashToken(plainToken),
+		Expiry: time.Now().Add(app.config.auth.token.refreshExp),
+	}
+	if err := app.store.RefreshTokens.Rotate(ctx, hashToken(payLoad.RefreshToken), refreshToken); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.unAuthorizedErrorResponse(w, r, fmt.Errorf("invalid refresh token"))
+		case errors.Is(err, store.ErrorTokenReused):
+			app.logger.Warnw("refresh token reuse detected, token family revoked", "user", refreshToken.UserID, "family", refreshToken.FamilyID)
+			//the family is the session, its access tokens go as well
+			if err := app.revokeSessionTokens(ctx, refreshToken.UserID, []string{refreshToken.FamilyID}); err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+			app.unAuthorizedErrorResponse(w, r, err)
 		default:
 			app.internalServerError(w, r, err)
 		}
 		return
 	}
-	if err := user.Password.Compare(payLoad.Password); err != nil {
-		app.unAuthorizedErrorResponse(w, r, err)
+	//the user may have been deactivated since the token was issued
+	user, err := app.store.Users.GetById(ctx, refreshToken.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.unAuthorizedErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	accessToken, err := app.generateAccessToken(user.ID, refreshToken.FamilyID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	tokens := &TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: plainToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(app.config.auth.token.exp.Seconds()),
+	}
+	app.writeTokens(w, r, tokens)
+}
+
+func (app *application) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	var payLoad LogoutPayload
+	//the body is optional, an empty one only revokes the access token
+	if err := readJson(w, r, &payLoad); err != nil && !errors.Is(err, io.EOF) {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payLoad); err != nil {
+		app.badRequestError(w, r, err)
 		return
 	}
+	ctx := r.Context()
+	user := getUserFromCtx(r)
+	claims := getClaimsFromCtx(r)
+	jti, _ := claims["jti"].(string)
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		app.unAuthorizedErrorResponse(w, r, fmt.Errorf("token is missing the exp claim"))
+		return
+	}
+	if err := app.revokeToken(ctx, jti, user.ID, exp.Time); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if sid, _ := claims["sid"].(string); sid != "" {
+		if err := app.revokeSession(ctx, user.ID, sid); err != nil && !errors.Is(err, store.ErrorNotFound) {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+	if payLoad.RefreshToken != "" {
+		err := app.store.RefreshTokens.RevokeFamilyByToken(ctx, user.ID, hashToken(payLoad.RefreshToken))
+		if err != nil && !errors.Is(err, store.ErrorNotFound) {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+	app.clearAuthCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// jwksHandler publishes the token verification keys as a plain JWK set,
+// without the data envelope, so standard JWT libraries can consume it.
+func (app *application) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := writeJson(w, http.StatusOK, app.authenticator.JWKS()); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// issueTokens starts a new session for the user, backed by a new refresh
+// token family, and pairs it with a short lived access token.
+func (app *application) issueTokens(r *http.Request, user *store.User) (*TokenResponse, error) {
+	ctx := r.Context()
+	session := &store.Session{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		UserAgent: truncate(r.UserAgent(), 512),
+		IP:        clientIP(r),
+	}
+	if err := app.store.Sessions.Create(ctx, session); err != nil {
+		return nil, err
+	}
+	accessToken, err := app.generateAccessToken(user.ID, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	plainToken := uuid.New().String()
+	refreshToken := &store.RefreshToken{
+		Token:    hashToken(plainToken),
+		UserID:   user.ID,
+		FamilyID: session.ID,
+		Expiry:   time.Now().Add(app.config.auth.token.refreshExp),
+	}
+	if err := app.store.RefreshTokens.Create(ctx, refreshToken); err != nil {
+		return nil, err
+	}
+	return &TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: plainToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(app.config.auth.token.exp.Seconds()),
+	}, nil
+}
+
+func (app *application) generateAccessToken(userID int64, sessionID string) (string, error) {
 	//generate the token --> add claims
 	claims := jwt.MapClaims{
-		"sub": user.ID,
+		"sub": userID,
+		"sid": sessionID,
+		"jti": uuid.New().String(),
 		"exp": time.Now().Add(app.config.auth.token.exp).Unix(),
 		"iat": time.Now().Unix(),
 		"nbf": time.Now().Unix(),
 		"iss": app.config.auth.token.iss,
 		"aud": app.config.auth.token.iss,
 	}
-	token, err := app.authenticator.GenerateToken(claims)
-	if err != nil {
-		app.internalServerError(w, r, err)
+	return app.authenticator.GenerateToken(claims)
+}
+
+// rehashPassword upgrades a hash made with an old algorithm or weaker
+// parameters while the plain password is at hand. Failing to do so does not
+// stop the login.
+func (app *application) rehashPassword(ctx context.Context, user *store.User, plain string) {
+	if err := user.Password.Set(app.passwordHasher, plain); err != nil {
+		app.logger.Warnw("could not rehash password", "user", user.ID, "error", err)
 		return
 	}
-	if err := app.jsonResponse(w, http.StatusCreated, token); err != nil {
-		app.internalServerError(w, r, err)
-
+	if err := app.store.Users.UpdatePasswordHash(ctx, user); err != nil {
+		app.logger.Warnw("could not store rehashed password", "user", user.ID, "error", err)
 	}
 }
+
+// hashToken hashes opaque tokens before they are stored, the same way
+// user invitation tokens are.
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
@@ -1,13 +1,34 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"strconv"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/vadiraj/gopher/internal/store"
 )
 
+type commentKey string
+
+const commentCtx commentKey = "comment"
+
 type AddCommentPayload struct {
 	Content string `json:"content" validate:"required,max=100"`
+	//ParentCommentID makes the comment a reply
+	ParentCommentID *int64 `json:"parent_comment_id" validate:"omitempty,gte=1"`
+}
+
+type UpdateCommentPayload struct {
+	Content string `json:"content" validate:"required,max=100"`
+}
+
+// defaultCommentQuery is used when a post is fetched with its comments.
+var defaultCommentQuery = store.PaginatedCommentQuery{
+	Limit:  20,
+	Offset: 0,
+	Depth:  3,
 }
 
 func (app *application) addCommentHandler(w http.ResponseWriter, r *http.Request) {
@@ -21,19 +42,151 @@ func (app *application) addCommentHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 	post := getPostFromCtx(r)
+	user := getUserFromCtx(r)
 	ctx := r.Context()
 	comment := &store.Comment{
-		Content: payLoad.Content,
-		PostID:  post.ID,
-		//todo remove after auth
-		UserID: 1,
+		Content:  payLoad.Content,
+		PostID:   post.ID,
+		UserID:   user.ID,
+		ParentID: payLoad.ParentCommentID,
 	}
 	if err := app.store.Comments.Create(ctx, comment); err != nil {
-		app.internalServerError(w, r, err)
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.failedValidationResponse(w, r, map[string][]string{"parent_comment_id": {"comment not found on this post"}})
+		case errors.Is(err, store.ErrorCommentTooDeep):
+			app.failedValidationResponse(w, r, map[string][]string{"parent_comment_id": {err.Error()}})
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
+	comment.Replies = []store.Comment{}
 	if err := app.jsonResponse(w, http.StatusCreated, comment); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 }
+
+func (app *application) listCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	cq, err := defaultCommentQuery.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(cq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	comments, err := app.store.Comments.GetByPostID(r.Context(), post.ID, cq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, comments); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// updateCommentHandler edits a comment. Only its author can do this,
+// moderators remove comments rather than rewrite them.
+func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+	if comment.UserID != getUserFromCtx(r).ID {
+		app.forbiddenResponse(w, r)
+		return
+	}
+	var payLoad UpdateCommentPayload
+	if err := readJson(w, r, &payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	from := comment.Content
+	comment.Content = payLoad.Content
+	if err := app.store.Comments.Update(r.Context(), comment); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			//the comment was edited or deleted after it was loaded
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.audit(r, "comment.update", auditTargetComment, strconv.FormatInt(comment.ID, 10), map[string]change{
+		"content": {From: from, To: comment.Content},
+	})
+	if err := app.jsonResponse(w, http.StatusOK, comment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// deleteCommentHandler moves a comment to the trash. It runs behind
+// CheckCommentOwnership, so authors and users allowed to delete any comment
+// can remove it. Replies stay and the comment shows as a placeholder.
+func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+	if err := app.store.Comments.Delete(r.Context(), comment.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.audit(r, "comment.delete", auditTargetComment, strconv.FormatInt(comment.ID, 10), map[string]any{
+		"author_id": comment.UserID,
+		"post_id":   comment.PostID,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CheckCommentOwnership is CheckPostOwnership for comments.
+func (app *application) CheckCommentOwnership(permission string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if getCommentFromCtx(r).UserID == getUserFromCtx(r).ID {
+			next.ServeHTTP(w, r)
+			return
+		}
+		app.RequirePermission(permission)(next).ServeHTTP(w, r)
+	})
+}
+
+// commentsContextMiddleware loads the comment from the URL. It runs after
+// postsContextMiddleware and only finds comments on that post.
+func (app *application) commentsContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "commentId"), 10, 64)
+		if err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+		ctx := r.Context()
+		comment, err := app.store.Comments.GetById(ctx, id)
+		if err == nil && comment.PostID != getPostFromCtx(r).ID {
+			err = store.ErrorNotFound
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrorNotFound):
+				app.notFoundError(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+		ctx = context.WithValue(ctx, commentCtx, comment)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getCommentFromCtx(r *http.Request) *store.Comment {
+	comment, _ := r.Context().Value(commentCtx).(*store.Comment)
+	return comment
+}
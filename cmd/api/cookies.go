@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vadiraj/gopher/internal/auth"
+)
+
+// Browser clients can ask for cookies instead of tokens in the response body
+// by sending X-Auth-Mode: cookie when they sign in. The access token then
+// lives in an HttpOnly cookie and requests authenticated with it have to
+// repeat the CSRF cookie in the X-CSRF-Token header (double submit) for
+// anything but safe methods.
+const (
+	authModeHeader    = "X-Auth-Mode"
+	csrfHeader        = "X-CSRF-Token"
+	sessionCookieName = "gs_session"
+	refreshCookieName = "gs_refresh"
+	csrfCookieName    = "gs_csrf"
+	//refreshCookiePath keeps the refresh token away from every other endpoint
+	refreshCookiePath = "/v1/authentication"
+)
+
+type cookieModeKey string
+
+const cookieModeCtx cookieModeKey = "cookieMode"
+
+// CookieSessionResponse replaces TokenResponse in cookie mode. The CSRF token
+// is included for frontends served from another site, which cannot read the
+// API's cookies.
+type CookieSessionResponse struct {
+	TokenType string `json:"token_type"`
+	ExpiresIn int64  `json:"expires_in"`
+	CSRFToken string `json:"csrf_token"`
+}
+
+func wantsCookieAuth(r *http.Request) bool {
+	if cookieMode, ok := r.Context().Value(cookieModeCtx).(bool); ok {
+		return cookieMode
+	}
+	return strings.EqualFold(r.Header.Get(authModeHeader), "cookie")
+}
+
+func withCookieMode(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), cookieModeCtx, true))
+}
+
+// writeTokens answers a successful sign-in or refresh, as cookies or in the
+// body depending on what the client asked for.
+func (app *application) writeTokens(w http.ResponseWriter, r *http.Request, tokens *TokenResponse) {
+	if !wantsCookieAuth(r) {
+		if err := app.jsonResponse(w, http.StatusCreated, tokens); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	csrfToken, err := auth.RandomToken(32)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.setCookie(w, sessionCookieName, tokens.AccessToken, "/", app.config.auth.token.exp, true)
+	app.setCookie(w, refreshCookieName, tokens.RefreshToken, refreshCookiePath, app.config.auth.token.refreshExp, true)
+	//readable by the frontend so it can echo it back
+	app.setCookie(w, csrfCookieName, csrfToken, "/", app.config.auth.token.refreshExp, false)
+	session := CookieSessionResponse{
+		TokenType: "Cookie",
+		ExpiresIn: tokens.ExpiresIn,
+		CSRFToken: csrfToken,
+	}
+	if err := app.jsonResponse(w, http.StatusCreated, session); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) clearAuthCookies(w http.ResponseWriter) {
+	app.setCookie(w, sessionCookieName, "", "/", -1, true)
+	app.setCookie(w, refreshCookieName, "", refreshCookiePath, -1, true)
+	app.setCookie(w, csrfCookieName, "", "/", -1, false)
+}
+
+func (app *application) setCookie(w http.ResponseWriter, name, value, path string, maxAge time.Duration, httpOnly bool) {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   app.config.auth.cookie.domain,
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: httpOnly,
+		Secure:   true,
+		SameSite: app.config.auth.cookie.sameSite,
+	}
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+}
+
+// validCSRF checks the double submitted CSRF token. Safe methods do not
+// need one.
+func validCSRF(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	cookie, err := r.Cookie(csrfCookieName)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.Header.Get(csrfHeader))) == 1
+}
+
+// CORSMiddleware lets the configured origins call the API from a browser,
+// with credentials so cookie mode works across origins.
+func (app *application) CORSMiddleware(next http.Handler) http.Handler {
+	allowedMethods := strings.Join([]string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions}, ", ")
+	allowedHeaders := strings.Join([]string{"Authorization", "Content-Type", csrfHeader, authModeHeader}, ", ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		if origin == "" || !slices.Contains(app.config.cors.allowedOrigins, origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		//preflight
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", allowedMethods)
+			w.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(app.config.cors.maxAge.Seconds())))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
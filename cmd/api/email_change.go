@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/vadiraj/gopher/internal/mailer"
+	"github.com/vadiraj/gopher/internal/store"
+)
+
+type ChangeEmailPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+// changeEmailHandler starts an email change. The new address gets a link
+// to confirm it and the current one a link to cancel the change.
+func (app *application) changeEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var payLoad ChangeEmailPayload
+	if err := readJson(w, r, &payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	user := getUserFromCtx(r)
+	if strings.EqualFold(payLoad.Email, user.Email) {
+		app.badRequestError(w, r, fmt.Errorf("email is unchanged"))
+		return
+	}
+	ctx := r.Context()
+	plainToken := uuid.New().String()
+	cancelToken := uuid.New().String()
+	err := app.store.Users.CreateEmailChange(ctx, user.ID, payLoad.Email, hashToken(plainToken), hashToken(cancelToken), app.config.mail.emailChangeExp)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorDuplicateEmail):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	isProdEnv := app.config.env == "production"
+	confirmVars := struct {
+		Username   string
+		ConfirmURL string
+		ExpiresIn  string
+	}{
+		Username:   user.UserName,
+		ConfirmURL: fmt.Sprintf("%s/confirm-email/%s", app.config.frontendUrl, plainToken),
+		ExpiresIn:  app.config.mail.emailChangeExp.String(),
+	}
+	if _, err := app.mailer.Send(mailer.EmailChangeConfirmTemplate, user.UserName, payLoad.Email, confirmVars, !isProdEnv); err != nil {
+		app.logger.Errorw("error sending the email change confirmation", "error", err)
+	}
+	noticeVars := struct {
+		Username  string
+		NewEmail  string
+		CancelURL string
+	}{
+		Username:  user.UserName,
+		NewEmail:  payLoad.Email,
+		CancelURL: fmt.Sprintf("%s/cancel-email-change/%s", app.config.frontendUrl, cancelToken),
+	}
+	if _, err := app.mailer.Send(mailer.EmailChangeNoticeTemplate, user.UserName, user.Email, noticeVars, !isProdEnv); err != nil {
+		app.logger.Errorw("error sending the email change notice", "error", err)
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (app *application) confirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := app.store.Users.ConfirmEmailChange(ctx, chi.URLParam(r, "token"))
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		case errors.Is(err, store.ErrorDuplicateEmail):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.invalidateCachedUser(ctx, user.ID)
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) cancelEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	if err := app.store.Users.CancelEmailChange(r.Context(), chi.URLParam(r, "token")); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func (app *application) internalServerError(w http.ResponseWriter, r *http.Request, err error) {
@@ -14,6 +17,16 @@ func (app *application) badRequestError(w http.ResponseWriter, r *http.Request,
 	writeJSONError(w, http.StatusBadRequest, err.Error())
 }
 
+// failedValidationResponse lists what is wrong with each field.
+func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, fields map[string][]string) {
+	app.logger.Warnf("failed validation error: ", r.Method, "path :", r.URL.Path, "fields:", fields)
+	type envelope struct {
+		Error  string              `json:"error"`
+		Fields map[string][]string `json:"fields"`
+	}
+	writeJson(w, http.StatusBadRequest, &envelope{Error: "validation failed", Fields: fields})
+}
+
 func (app *application) notFoundError(w http.ResponseWriter, r *http.Request, err error) {
 	app.logger.Warnf("not found error: ", r.Method, "path :", r.URL.Path, "error:", err)
 	writeJSONError(w, http.StatusNotFound, "not found")
@@ -39,3 +52,30 @@ func (app *application) forbiddenResponse(w http.ResponseWriter, r *http.Request
 	app.logger.Warnf("forbidden error: ", r.Method, "path :", r.URL.Path)
 	writeJSONError(w, http.StatusForbidden, "forbidden")
 }
+
+func (app *application) forbiddenErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnf("forbidden error: ", r.Method, "path :", r.URL.Path, "error:", err)
+	writeJSONError(w, http.StatusForbidden, err.Error())
+}
+
+func (app *application) invalidCSRFTokenResponse(w http.ResponseWriter, r *http.Request) {
+	app.logger.Warnf("invalid csrf token error: ", r.Method, "path :", r.URL.Path)
+	writeJSONError(w, http.StatusForbidden, "missing or invalid csrf token")
+}
+
+func (app *application) twoFactorRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	app.logger.Warnf("two-factor required error: ", r.Method, "path :", r.URL.Path)
+	writeJSONError(w, http.StatusForbidden, "two-factor authentication is required for this role")
+}
+
+func (app *application) insufficientScopeResponse(w http.ResponseWriter, r *http.Request, scope string) {
+	app.logger.Warnf("insufficient scope error: ", r.Method, "path :", r.URL.Path, "scope:", scope)
+	w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope",scope="`+scope+`"`)
+	writeJSONError(w, http.StatusForbidden, "token is missing the "+scope+" scope")
+}
+
+func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	app.logger.Warnw("rate limit exceeded", "method", r.Method, "path", r.URL.Path, "retry_after", retryAfter)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	writeJSONError(w, http.StatusTooManyRequests, "rate limit exceeded, retry after "+retryAfter.Round(time.Second).String())
+}
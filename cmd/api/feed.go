@@ -17,14 +17,18 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 	fq, err := fq.Parse(r)
 	if err != nil {
 		app.badRequestError(w, r, err)
+		return
 	}
 	if err := Validate.Struct(fq); err != nil {
 		app.badRequestError(w, r, err)
+		return
 	}
-
-	feed, err := app.store.Posts.GetUserFeed(ctx, int64(108), fq)
+	//the feed includes the caller's own drafts and scheduled posts
+	user := getUserFromCtx(r)
+	feed, err := app.store.Posts.GetUserFeed(ctx, user.ID, fq)
 	if err != nil {
 		app.internalServerError(w, r, err)
+		return
 	}
 	if err := app.jsonResponse(w, http.StatusOK, feed); err != nil {
 		app.internalServerError(w, r, err)
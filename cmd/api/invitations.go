@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/vadiraj/gopher/internal/mailer"
+	"github.com/vadiraj/gopher/internal/store"
+)
+
+type ResendActivationPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+// resendActivationHandler mails a fresh activation link and invalidates the
+// old ones. Like forgotPasswordHandler it answers 202 whether or not the
+// email belongs to an account waiting for activation.
+func (app *application) resendActivationHandler(w http.ResponseWriter, r *http.Request) {
+	var payLoad ResendActivationPayload
+	if err := readJson(w, r, &payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	ctx := r.Context()
+	allowed, retryAfter, err := app.activationLimiter.Allow(ctx, strings.ToLower(payLoad.Email))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !allowed {
+		app.rateLimitExceededResponse(w, r, retryAfter)
+		return
+	}
+	plainToken := uuid.New().String()
+	user, err := app.store.Users.ReissueInvitation(ctx, payLoad.Email, hashToken(plainToken), app.config.mail.exp)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := app.sendActivationEmail(user, plainToken); err != nil {
+		app.logger.Errorw("error sending the activation email", "error", err)
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (app *application) sendActivationEmail(user *store.User, plainToken string) error {
+	isProdEnv := app.config.env == "production"
+	vars := struct {
+		Username      string
+		ActivationURL string
+	}{
+		Username:      user.UserName,
+		ActivationURL: fmt.Sprintf("%s/confirm/%s", app.config.frontendUrl, plainToken),
+	}
+	_, err := app.mailer.Send(mailer.UserWelcomeTemplate, user.UserName, user.Email, vars, !isProdEnv)
+	return err
+}
+
+// cleanupInvitations removes accounts that were never activated once their
+// invitation has been expired for longer than the grace period.
+func (app *application) cleanupInvitations(ctx context.Context) error {
+	deleted, err := app.store.Users.DeleteExpiredInvitations(ctx, app.config.mail.invitations.grace)
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		app.logger.Infow("removed never activated users", "count", deleted)
+	}
+	return nil
+}
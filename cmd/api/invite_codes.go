@@ -0,0 +1,248 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/vadiraj/gopher/internal/mailer"
+	"github.com/vadiraj/gopher/internal/store"
+)
+
+// inviteCodeAlphabet leaves out characters that are easy to mix up when a
+// code is typed in by hand.
+const inviteCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+const inviteCodeLength = 10
+
+const auditTargetInviteCode = "invite_code"
+
+type MintInviteCodesPayload struct {
+	Count   int `json:"count" validate:"required,gte=1,lte=100"`
+	MaxUses int `json:"max_uses" validate:"omitempty,gte=1,lte=1000"`
+	//ExpiresIn is a duration such as 72h, empty uses the configured default
+	ExpiresIn string `json:"expires_in" validate:"max=20"`
+}
+
+type JoinWaitlistPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+type InviteWaitlistPayload struct {
+	Count int `json:"count" validate:"required,gte=1,lte=100"`
+}
+
+func newInviteCode() (string, error) {
+	code := make([]byte, inviteCodeLength)
+	max := big.NewInt(int64(len(inviteCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = inviteCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// newInviteCodes prepares n codes. createdBy is nil for break-glass access.
+func newInviteCodes(n, maxUses int, createdBy *int64, exp time.Duration) ([]*store.InviteCode, error) {
+	var expiry *time.Time
+	if exp > 0 {
+		t := time.Now().Add(exp)
+		expiry = &t
+	}
+	codes := make([]*store.InviteCode, 0, n)
+	for range n {
+		code, err := newInviteCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, &store.InviteCode{
+			Code:      code,
+			CreatedBy: createdBy,
+			MaxUses:   maxUses,
+			Expiry:    expiry,
+		})
+	}
+	return codes, nil
+}
+
+func (app *application) listInviteCodesHandler(w http.ResponseWriter, r *http.Request) {
+	codes, err := app.store.InviteCodes.GetByCreator(r.Context(), getUserFromCtx(r).ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, codes); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// createInviteCodeHandler gives the user a single use code to pass on, out
+// of their quota.
+func (app *application) createInviteCodeHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	codes, err := newInviteCodes(1, 1, &user.ID, app.config.auth.invites.exp)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	code := codes[0]
+	if err := app.store.InviteCodes.CreateWithinQuota(r.Context(), code, app.config.auth.invites.userQuota); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorInviteQuota):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.audit(r, "invite_code.create", auditTargetInviteCode, strconv.FormatInt(code.ID, 10), nil)
+	if err := app.jsonResponse(w, http.StatusCreated, code); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// mintInviteCodesHandler lets admins create a batch of codes outside of any
+// quota.
+func (app *application) mintInviteCodesHandler(w http.ResponseWriter, r *http.Request) {
+	var payLoad MintInviteCodesPayload
+	if err := readJson(w, r, &payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if payLoad.MaxUses == 0 {
+		payLoad.MaxUses = 1
+	}
+	exp := app.config.auth.invites.exp
+	if payLoad.ExpiresIn != "" {
+		d, err := time.ParseDuration(payLoad.ExpiresIn)
+		if err != nil || d <= 0 {
+			app.badRequestError(w, r, fmt.Errorf("expires_in must be a positive duration"))
+			return
+		}
+		exp = d
+	}
+	var createdBy *int64
+	if admin := getUserFromCtx(r); admin != nil {
+		createdBy = &admin.ID
+	}
+	codes, err := newInviteCodes(payLoad.Count, payLoad.MaxUses, createdBy, exp)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.store.InviteCodes.CreateBatch(r.Context(), codes); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	for _, code := range codes {
+		app.audit(r, "invite_code.create", auditTargetInviteCode, strconv.FormatInt(code.ID, 10), map[string]any{"max_uses": code.MaxUses})
+	}
+	if err := app.jsonResponse(w, http.StatusCreated, codes); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// joinWaitlistHandler answers 202 whether or not the email was already on
+// the list.
+func (app *application) joinWaitlistHandler(w http.ResponseWriter, r *http.Request) {
+	var payLoad JoinWaitlistPayload
+	if err := readJson(w, r, &payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := app.store.Waitlist.Add(r.Context(), payLoad.Email); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (app *application) listWaitlistHandler(w http.ResponseWriter, r *http.Request) {
+	wq := store.PaginatedWaitlistQuery{
+		Limit:  20,
+		Offset: 0,
+	}
+	wq, err := wq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(wq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	entries, err := app.store.Waitlist.List(r.Context(), wq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, entries); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// inviteWaitlistHandler emails a single use code to the count people who
+// have been waiting the longest.
+func (app *application) inviteWaitlistHandler(w http.ResponseWriter, r *http.Request) {
+	var payLoad InviteWaitlistPayload
+	if err := readJson(w, r, &payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	var createdBy *int64
+	if admin := getUserFromCtx(r); admin != nil {
+		createdBy = &admin.ID
+	}
+	exp := app.config.auth.invites.exp
+	codes, err := newInviteCodes(payLoad.Count, 1, createdBy, exp)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	entries, err := app.store.Waitlist.Invite(r.Context(), codes)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	isProdEnv := app.config.env == "production"
+	for _, entry := range entries {
+		vars := struct {
+			Code        string
+			RegisterURL string
+			ExpiresIn   string
+		}{
+			Code:        entry.InviteCode,
+			RegisterURL: fmt.Sprintf("%s/register?invite=%s", app.config.frontendUrl, url.QueryEscape(entry.InviteCode)),
+		}
+		if exp > 0 {
+			vars.ExpiresIn = exp.String()
+		}
+		if _, err := app.mailer.Send(mailer.WaitlistInviteTemplate, entry.Email, entry.Email, vars, !isProdEnv); err != nil {
+			app.logger.Errorw("error sending the waitlist invite", "email", entry.Email, "error", err)
+		}
+		app.audit(r, "waitlist.invite", auditTargetInviteCode, strconv.FormatInt(*entry.InviteCodeID, 10), map[string]any{"email": entry.Email})
+	}
+	if err := app.jsonResponse(w, http.StatusCreated, entries); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// startJobs runs the background maintenance jobs until ctx is cancelled.
+func (app *application) startJobs(ctx context.Context, wg *sync.WaitGroup) {
+	app.runEvery(ctx, wg, "invitation cleanup", app.config.mail.invitations.cleanupInterval, app.cleanupInvitations)
+	app.runEvery(ctx, wg, "session last seen flush", app.config.auth.sessions.lastSeenFlush, app.flushLastSeen)
+	app.runEvery(ctx, wg, "trash purge", app.config.trash.purgeInterval, app.purgeTrash)
+	app.runEvery(ctx, wg, "scheduled post publisher", app.config.publishInterval, app.publishScheduledPosts)
+}
+
+// runEvery calls fn every interval. A failed run is logged and retried on
+// the next tick.
+func (app *application) runEvery(ctx context.Context, wg *sync.WaitGroup, name string, interval time.Duration, fn func(context.Context) error) {
+	if interval <= 0 {
+		return
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := fn(ctx); err != nil && ctx.Err() == nil {
+					app.logger.Errorw("background job failed", "job", name, "error", err)
+				}
+			}
+		}
+	}()
+}
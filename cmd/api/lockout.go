@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vadiraj/gopher/internal/mailer"
+	"github.com/vadiraj/gopher/internal/store"
+)
+
+var errInvalidCredentials = errors.New("invalid email or password")
+
+func loginAccountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// clientIP is the address of the connection without its port. Forwarding
+// headers only replace it, through the RealIP middleware, when
+// trustProxyHeaders is on, so they cannot be used to dodge per-IP limits.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// loginLockedFor returns how long logins for the email or from the ip are
+// still locked, whichever is longer.
+func (app *application) loginLockedFor(ctx context.Context, email, ip string) (time.Duration, error) {
+	accountLocked, err := app.accountLockout.Locked(ctx, loginAccountKey(email))
+	if err != nil {
+		return 0, err
+	}
+	ipLocked, err := app.ipLockout.Locked(ctx, ip)
+	if err != nil {
+		return 0, err
+	}
+	return max(accountLocked, ipLocked), nil
+}
+
+// recordLoginFailure counts a failed login against the account and the ip and
+// returns the lockout it triggered. The owner of a known account is emailed
+// when the account gets locked.
+func (app *application) recordLoginFailure(ctx context.Context, user *store.User, email, ip string) (time.Duration, error) {
+	accountLocked, err := app.accountLockout.Fail(ctx, loginAccountKey(email))
+	if err != nil {
+		return 0, err
+	}
+	ipLocked, err := app.ipLockout.Fail(ctx, ip)
+	if err != nil {
+		return 0, err
+	}
+	if accountLocked > 0 && user != nil {
+		app.logger.Warnw("account locked after failed logins", "user", user.ID, "ip", ip, "locked_for", accountLocked)
+		go app.sendAccountLockedEmail(user, ip, accountLocked)
+	}
+	return max(accountLocked, ipLocked), nil
+}
+
+// loginFailed records a failed login and answers it. Unknown emails and
+// wrong passwords get the same answer, including when the failure locks
+// the account.
+func (app *application) loginFailed(w http.ResponseWriter, r *http.Request, user *store.User, email, ip string) {
+	locked, err := app.recordLoginFailure(r.Context(), user, email, ip)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if locked > 0 {
+		app.rateLimitExceededResponse(w, r, locked)
+		return
+	}
+	app.unAuthorizedErrorResponse(w, r, errInvalidCredentials)
+}
+
+func (app *application) sendAccountLockedEmail(user *store.User, ip string, lockedFor time.Duration) {
+	isProdEnv := app.config.env == "production"
+	vars := struct {
+		Username  string
+		IP        string
+		LockedFor string
+		ResetURL  string
+	}{
+		Username:  user.UserName,
+		IP:        ip,
+		LockedFor: lockedFor.Round(time.Second).String(),
+		ResetURL:  fmt.Sprintf("%s/forgot-password", app.config.frontendUrl),
+	}
+	if _, err := app.mailer.Send(mailer.AccountLockedTemplate, user.UserName, user.Email, vars, !isProdEnv); err != nil {
+		app.logger.Errorw("error sending the account locked email", "error", err)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/vadiraj/gopher/internal/mailer"
+	"github.com/vadiraj/gopher/internal/store"
+)
+
+type MagicLinkPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+type MagicLinkExchangePayload struct {
+	Token string `json:"token" validate:"required,max=100"`
+}
+
+// magicLinkHandler emails a single use sign in link. Like
+// forgotPasswordHandler it answers 202 whether or not the email has an
+// account.
+func (app *application) magicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	var payLoad MagicLinkPayload
+	if err := readJson(w, r, &payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	ctx := r.Context()
+	allowed, retryAfter, err := app.magicLinkIPLimiter.Allow(ctx, clientIP(r))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !allowed {
+		app.rateLimitExceededResponse(w, r, retryAfter)
+		return
+	}
+	allowed, retryAfter, err = app.magicLinkEmailLimiter.Allow(ctx, loginAccountKey(payLoad.Email))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !allowed {
+		app.rateLimitExceededResponse(w, r, retryAfter)
+		return
+	}
+	user, err := app.store.Users.GetByEmail(ctx, payLoad.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	plainToken := uuid.New().String()
+	exp := app.config.auth.magicLink.exp
+	if err := app.store.Users.CreateMagicLink(ctx, user.ID, hashToken(plainToken), exp); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	isProdEnv := app.config.env == "production"
+	vars := struct {
+		Username  string
+		LoginURL  string
+		ExpiresIn string
+	}{
+		Username:  user.UserName,
+		LoginURL:  fmt.Sprintf("%s/magic-login/%s", app.config.frontendUrl, plainToken),
+		ExpiresIn: exp.String(),
+	}
+	if _, err := app.mailer.Send(mailer.MagicLinkTemplate, user.UserName, user.Email, vars, !isProdEnv); err != nil {
+		app.logger.Errorw("error sending the magic link email", "error", err)
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// magicLinkExchangeHandler signs the user in with the token from the link.
+// Users with two-factor authentication still get a challenge.
+func (app *application) magicLinkExchangeHandler(w http.ResponseWriter, r *http.Request) {
+	var payLoad MagicLinkExchangePayload
+	if err := readJson(w, r, &payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	user, err := app.store.Users.ConsumeMagicLink(r.Context(), payLoad.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.unAuthorizedErrorResponse(w, r, fmt.Errorf("invalid or expired sign in link"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.completeLogin(w, r, user)
+}
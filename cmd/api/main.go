@@ -1,14 +1,23 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"net/http"
+	"strings"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 	"github.com/vadiraj/gopher/internal/auth"
 	"github.com/vadiraj/gopher/internal/db"
 	"github.com/vadiraj/gopher/internal/env"
+	"github.com/vadiraj/gopher/internal/hashing"
 	"github.com/vadiraj/gopher/internal/mailer"
+	"github.com/vadiraj/gopher/internal/passwords"
+	"github.com/vadiraj/gopher/internal/ratelimiter"
 	"github.com/vadiraj/gopher/internal/store"
 	"github.com/vadiraj/gopher/internal/store/cache"
 	"go.uber.org/zap"
@@ -51,9 +60,22 @@ func main() {
 			enabled: env.GetBool("REDIS_ENABLED", false),
 		},
 		env: env.GetString("ENV", "development"),
+		cors: corsConfig{
+			allowedOrigins: env.GetStrings("CORS_ALLOWED_ORIGINS", []string{"http://localhost:4000"}),
+			maxAge:         env.GetDuration("CORS_MAX_AGE", time.Minute*5),
+		},
+		publishInterval:   env.GetDuration("POST_PUBLISH_INTERVAL", time.Second*30),
+		reactions:         env.GetStrings("REACTIONS_ALLOWED", []string{"like", "love", "laugh", "wow", "sad", "celebrate"}),
+		trustProxyHeaders: env.GetBool("TRUST_PROXY_HEADERS", false),
+		trash: trashConfig{
+			retention:     env.GetDuration("TRASH_RETENTION", time.Hour*24*30),
+			purgeInterval: env.GetDuration("TRASH_PURGE_INTERVAL", time.Hour),
+		},
 		mail: mailConfig{
-			exp:       time.Hour * 24 * 3, //3 days
-			fromEmail: env.GetString("FROM_EMAIL", ""),
+			exp:            time.Hour * 24 * 3, //3 days
+			resetExp:       time.Hour,
+			emailChangeExp: time.Hour * 24,
+			fromEmail:      env.GetString("FROM_EMAIL", ""),
 			sendGrid: sendGridConfig{
 				apiKey: env.GetString("SENDGRID_API_KEY", ""),
 			},
@@ -61,16 +83,70 @@ func main() {
 				username: env.GetString("MAILTRAP_USERNAME", ""),
 				password: env.GetString("MAILTRAP_PASSWORD", ""),
 			},
+			invitations: invitationConfig{
+				resendLimit:     env.GetInt("ACTIVATION_RESEND_LIMIT", 3),
+				resendWindow:    env.GetDuration("ACTIVATION_RESEND_WINDOW", time.Hour),
+				grace:           env.GetDuration("INVITATION_GRACE_PERIOD", time.Hour*24*7),
+				cleanupInterval: env.GetDuration("INVITATION_CLEANUP_INTERVAL", time.Hour),
+			},
 		},
 		auth: authConfig{
 			basic: basicConfig{
 				user: env.GetString("AUTH_BASIC_USER", "admin"),
 				pass: env.GetString("AUTH_BASIC_PASSWORD", "admin"),
+				//off by default, the fallback credentials are not secret
+				adminEnabled: env.GetBool("ADMIN_BASIC_AUTH_ENABLED", false),
+			},
+			login: loginConfig{
+				maxAttempts:   env.GetInt("LOGIN_MAX_ATTEMPTS", 5),
+				ipMaxAttempts: env.GetInt("LOGIN_IP_MAX_ATTEMPTS", 20),
+				window:        env.GetDuration("LOGIN_ATTEMPT_WINDOW", time.Minute*15),
+				baseLockout:   env.GetDuration("LOGIN_LOCKOUT_BASE", time.Minute),
+				maxLockout:    env.GetDuration("LOGIN_LOCKOUT_MAX", time.Hour),
 			},
 			token: tokenConfig{
-				secret: env.GetString("AUTH_TOKEN_SECRET", "example"),
-				exp:    time.Hour * 24 * 3,
-				iss:    "gophersocial",
+				secret:     env.GetString("AUTH_TOKEN_SECRET", "example"),
+				exp:        time.Minute * 15,
+				refreshExp: time.Hour * 24 * 7, //7 days
+				iss:        "gophersocial",
+				keys: tokenKeysConfig{
+					alg:            env.GetString("AUTH_TOKEN_ALG", "HS256"),
+					signingKeyID:   env.GetString("AUTH_TOKEN_SIGNING_KEY_ID", ""),
+					signingKeyFile: env.GetString("AUTH_TOKEN_SIGNING_KEY_FILE", ""),
+					verify:         env.GetString("AUTH_TOKEN_VERIFY_KEYS", ""),
+				},
+			},
+			oidc: oidcProvidersFromEnv(),
+			sessions: sessionConfig{
+				lastSeenFlush: env.GetDuration("SESSION_LAST_SEEN_FLUSH_INTERVAL", time.Minute),
+			},
+			//raising any of these rehashes passwords on the next login
+			password: hashing.Argon2idParams{
+				Memory:      uint32(env.GetInt("PASSWORD_ARGON2_MEMORY_KIB", 64*1024)),
+				Iterations:  uint32(env.GetInt("PASSWORD_ARGON2_ITERATIONS", 3)),
+				Parallelism: uint8(env.GetInt("PASSWORD_ARGON2_PARALLELISM", 2)),
+				SaltLength:  16,
+				KeyLength:   32,
+			},
+			policy: passwordPolicyConfig{
+				minLength:   env.GetInt("PASSWORD_MIN_LENGTH", 10),
+				minScore:    env.GetInt("PASSWORD_MIN_SCORE", 2),
+				breachedDir: env.GetString("PASSWORD_BREACHED_DIR", ""),
+			},
+			magicLink: magicLinkConfig{
+				exp:        env.GetDuration("MAGIC_LINK_EXP", time.Minute*15),
+				emailLimit: env.GetInt("MAGIC_LINK_EMAIL_LIMIT", 3),
+				ipLimit:    env.GetInt("MAGIC_LINK_IP_LIMIT", 10),
+				window:     env.GetDuration("MAGIC_LINK_WINDOW", time.Hour),
+			},
+			invites: inviteCodeConfig{
+				required:  env.GetBool("REGISTRATION_INVITE_ONLY", false),
+				userQuota: env.GetInt("INVITE_CODE_USER_QUOTA", 5),
+				exp:       env.GetDuration("INVITE_CODE_EXP", time.Hour*24*14),
+			},
+			cookie: cookieConfig{
+				domain:   env.GetString("COOKIE_DOMAIN", ""),
+				sameSite: parseSameSite(env.GetString("COOKIE_SAMESITE", "lax")),
 			},
 		},
 	}
@@ -88,22 +164,169 @@ func main() {
 		logger.Info("redis connection established")
 	}
 	defer db.Close()
-	store := store.NewStorage(db)
+	passwordHasher := hashing.NewArgon2id(cfg.auth.password)
+	dummyPasswordHash, err := passwordHasher.Hash(uuid.New().String())
+	if err != nil {
+		logger.Fatal(err)
+	}
+	store := store.NewStorage(db, passwordHasher)
 	cacheStorage := cache.NewRedisStorage(rdb)
 	//mailer:=mailer.NewSendGrid(cfg.mail.sendGrid.apiKey,cfg.mail.fromEmail)
 	mailer, err := mailer.NewMailTrap(cfg.mail.mailTrap.username, cfg.mail.mailTrap.password, cfg.mail.fromEmail)
 	if err != nil {
 		log.Fatal(err)
 	}
-	jwtAuthenticator := auth.NewJWTAuthenticator(cfg.auth.token.secret, cfg.auth.token.iss, cfg.auth.token.iss)
+	jwtAuthenticator, err := newAuthenticator(cfg.auth.token)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	accountLockout, ipLockout := newLoginLockouts(cfg, rdb)
+	passwordPolicy, err := newPasswordPolicy(cfg.auth.policy)
+	if err != nil {
+		logger.Fatal(err)
+	}
 	app := &application{
-		config:        cfg,
-		store:         store,
-		cacheStorage:  *cacheStorage,
-		logger:        logger,
-		mailer:        mailer,
-		authenticator: jwtAuthenticator,
+		config:            cfg,
+		store:             store,
+		cacheStorage:      *cacheStorage,
+		logger:            logger,
+		mailer:            mailer,
+		authenticator:     jwtAuthenticator,
+		accountLockout:    accountLockout,
+		ipLockout:         ipLockout,
+		oidcProviders:     newOIDCProviders(cfg.auth.oidc, logger),
+		lastSeen:          newLastSeenTracker(),
+		passwordPolicy:    passwordPolicy,
+		passwordHasher:    passwordHasher,
+		dummyPasswordHash: dummyPasswordHash,
+		magicLinkEmailLimiter: newLimiter(rdb, "magic-link-email", ratelimiter.LimiterConfig{
+			Limit:  cfg.auth.magicLink.emailLimit,
+			Window: cfg.auth.magicLink.window,
+		}),
+		magicLinkIPLimiter: newLimiter(rdb, "magic-link-ip", ratelimiter.LimiterConfig{
+			Limit:  cfg.auth.magicLink.ipLimit,
+			Window: cfg.auth.magicLink.window,
+		}),
+		activationLimiter: newLimiter(rdb, "activation-resend", ratelimiter.LimiterConfig{
+			Limit:  cfg.mail.invitations.resendLimit,
+			Window: cfg.mail.invitations.resendWindow,
+		}),
 	}
 	mux := app.mount()
 	logger.Fatal(app.run(mux))
 }
+
+func newAuthenticator(cfg tokenConfig) (*auth.JWTAuthenticator, error) {
+	if cfg.keys.alg == jwt.SigningMethodHS256.Alg() {
+		return auth.NewJWTAuthenticator(cfg.secret, cfg.iss, cfg.iss), nil
+	}
+	signingKey, err := auth.LoadKeyFromPEM(cfg.keys.signingKeyID, cfg.keys.signingKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if signingKey.Method.Alg() != cfg.keys.alg {
+		return nil, fmt.Errorf("signing key %s is a %s key, AUTH_TOKEN_ALG is %s", signingKey.ID, signingKey.Method.Alg(), cfg.keys.alg)
+	}
+	var verifyKeys []*auth.Key
+	for _, entry := range strings.Split(cfg.keys.verify, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kid, path, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid verify key %q, expected kid=path", entry)
+		}
+		key, err := auth.LoadKeyFromPEM(kid, path)
+		if err != nil {
+			return nil, err
+		}
+		verifyKeys = append(verifyKeys, key)
+	}
+	return auth.NewKeyedJWTAuthenticator(signingKey, verifyKeys, cfg.iss, cfg.iss)
+}
+
+func newLoginLockouts(cfg config, rdb *redis.Client) (ratelimiter.Lockout, ratelimiter.Lockout) {
+	account := ratelimiter.Config{
+		MaxAttempts: cfg.auth.login.maxAttempts,
+		Window:      cfg.auth.login.window,
+		BaseLockout: cfg.auth.login.baseLockout,
+		MaxLockout:  cfg.auth.login.maxLockout,
+	}
+	ip := account
+	ip.MaxAttempts = cfg.auth.login.ipMaxAttempts
+	if cfg.redisCfg.enabled {
+		return ratelimiter.NewRedisLockout(rdb, "login-account", account), ratelimiter.NewRedisLockout(rdb, "login-ip", ip)
+	}
+	return ratelimiter.NewMemoryLockout(account), ratelimiter.NewMemoryLockout(ip)
+}
+
+func newPasswordPolicy(cfg passwordPolicyConfig) (*passwords.Policy, error) {
+	policy := &passwords.Policy{
+		MinLength: cfg.minLength,
+		MinScore:  cfg.minScore,
+	}
+	if cfg.breachedDir != "" {
+		breached, err := passwords.NewRangeDir(cfg.breachedDir)
+		if err != nil {
+			return nil, err
+		}
+		policy.Breached = breached
+	}
+	return policy, nil
+}
+
+func parseSameSite(mode string) http.SameSite {
+	switch strings.ToLower(mode) {
+	case "strict":
+		return http.SameSiteStrictMode
+	//needed when the frontend is served from another site
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+func newLimiter(rdb *redis.Client, prefix string, cfg ratelimiter.LimiterConfig) ratelimiter.Limiter {
+	if rdb != nil {
+		return ratelimiter.NewRedisLimiter(rdb, prefix, cfg)
+	}
+	return ratelimiter.NewMemoryLimiter(cfg)
+}
+
+// oidcProvidersFromEnv reads the providers named in OIDC_PROVIDERS, each
+// configured through OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET,
+// _REDIRECT_URL and optionally _SCOPES.
+func oidcProvidersFromEnv() []auth.OIDCConfig {
+	var providers []auth.OIDCConfig
+	for _, name := range env.GetStrings("OIDC_PROVIDERS", nil) {
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		providers = append(providers, auth.OIDCConfig{
+			Name:         strings.ToLower(name),
+			Issuer:       env.GetString(prefix+"ISSUER", ""),
+			ClientID:     env.GetString(prefix+"CLIENT_ID", ""),
+			ClientSecret: env.GetString(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  env.GetString(prefix+"REDIRECT_URL", ""),
+			Scopes:       env.GetStrings(prefix+"SCOPES", nil),
+		})
+	}
+	return providers
+}
+
+// newOIDCProviders runs discovery for every configured provider. A provider
+// that cannot be reached is left out rather than keeping the API down.
+func newOIDCProviders(cfgs []auth.OIDCConfig, logger *zap.SugaredLogger) map[string]*auth.OIDCProvider {
+	providers := make(map[string]*auth.OIDCProvider, len(cfgs))
+	for _, cfg := range cfgs {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		provider, err := auth.NewOIDCProvider(ctx, cfg, nil)
+		cancel()
+		if err != nil {
+			logger.Errorw("oidc provider disabled", "provider", cfg.Name, "error", err)
+			continue
+		}
+		providers[cfg.Name] = provider
+	}
+	return providers
+}
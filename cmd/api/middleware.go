@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/vadiraj/gopher/internal/store"
@@ -49,16 +50,39 @@ func (app *application) BasicAuthMiddleware(next http.Handler) http.Handler {
 func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
+		var token string
+		fromCookie := false
 		if authHeader == "" {
-			app.unAuthorizedErrorResponse(w, r, fmt.Errorf("authorization header is missing"))
+			//browser clients in cookie mode
+			cookie, err := r.Cookie(sessionCookieName)
+			if err != nil {
+				app.unAuthorizedErrorResponse(w, r, fmt.Errorf("authorization header is missing"))
+				return
+			}
+			token, fromCookie = cookie.Value, true
+		} else {
+			parts := strings.Split(authHeader, " ")
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				app.unAuthorizedErrorResponse(w, r, fmt.Errorf("authorization header is ,alformed"))
+				return
+			}
+			token = parts[1]
+		}
+		if fromCookie && !validCSRF(r) {
+			app.invalidCSRFTokenResponse(w, r)
 			return
 		}
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			app.unAuthorizedErrorResponse(w, r, fmt.Errorf("authorization header is ,alformed"))
+		if !fromCookie && strings.HasPrefix(token, accessTokenPrefix) {
+			user, scopes, err := app.authenticateAccessToken(r.Context(), token)
+			if err != nil {
+				app.unAuthorizedErrorResponse(w, r, err)
+				return
+			}
+			ctx := context.WithValue(r.Context(), userCtx, user)
+			ctx = context.WithValue(ctx, scopesCtx, scopes)
+			next.ServeHTTP(w, r.WithContext(ctx))
 			return
 		}
-		token := parts[1]
 		jwtToken, err := app.authenticator.ValidateToken(token)
 		if err != nil {
 			app.unAuthorizedErrorResponse(w, r, err)
@@ -70,45 +94,109 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 			app.unAuthorizedErrorResponse(w, r, err)
 			return
 		}
+		jti, _ := claims["jti"].(string)
+		if jti == "" {
+			app.unAuthorizedErrorResponse(w, r, fmt.Errorf("token is missing the jti claim"))
+			return
+		}
 		ctx := r.Context()
+		revoked, err := app.isTokenRevoked(ctx, jti)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if revoked {
+			app.unAuthorizedErrorResponse(w, r, fmt.Errorf("token has been revoked"))
+			return
+		}
+		sid, _ := claims["sid"].(string)
+		if sid != "" {
+			revoked, err := app.isTokenRevoked(ctx, sessionRevocationKey(sid))
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+			if revoked {
+				app.unAuthorizedErrorResponse(w, r, fmt.Errorf("session has been revoked"))
+				return
+			}
+		}
 		user, err := app.getUser(ctx, userId)
 		if err != nil {
 			app.unAuthorizedErrorResponse(w, r, err)
 			return
 		}
+		if sid != "" {
+			app.lastSeen.touch(sid, time.Now())
+		}
 		ctx = context.WithValue(ctx, userCtx, user)
+		ctx = context.WithValue(ctx, claimsCtx, claims)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-func (app *application) CheckPostOwnership(role string, next http.HandlerFunc) http.HandlerFunc {
+// CheckPostOwnership lets the author through, and anyone else only when
+// their role grants permission.
+func (app *application) CheckPostOwnership(permission string, next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := getUserFromCtx(r)
 		post := getPostFromCtx(r)
 		//if it is the user post
 		if post.UserID == user.ID {
 			next.ServeHTTP(w, r)
-		}
-		//role precedence check
-		allowed, err := app.checkRolePrecedence(r.Context(), user, role)
-		if err != nil {
-			app.internalServerError(w, r, err)
 			return
 		}
-		if !allowed {
-			app.forbiddenResponse(w, r)
-			return
-		}
-		next.ServeHTTP(w, r)
+		app.RequirePermission(permission)(next).ServeHTTP(w, r)
 	})
 }
 
-func (app *application) checkRolePrecedence(ctx context.Context, user *store.User, roleName string) (bool, error) {
-	role, err := app.store.Roles.GetByName(ctx, roleName)
-	if err != nil {
-		return false, err
+// RequirePermission only lets users whose role grants permission through.
+// Break-glass admin access holds every permission.
+func (app *application) RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isBreakGlass(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			user := getUserFromCtx(r)
+			allowed, err := app.store.Roles.HasPermission(r.Context(), user.Role.Id, permission)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+			if !allowed {
+				app.forbiddenResponse(w, r)
+				return
+			}
+			//roles that require 2FA only get their extra privileges once enrolled
+			if user.Role.Requires2FA && !user.TwoFactorEnabled {
+				app.twoFactorRequiredResponse(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (app *application) isTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	if !app.config.redisCfg.enabled {
+		return app.store.RevokedTokens.IsRevoked(ctx, jti)
+	}
+	return app.cacheStorage.Tokens.IsRevoked(ctx, jti)
+}
+
+func (app *application) revokeToken(ctx context.Context, jti string, userID int64, expiry time.Time) error {
+	if !app.config.redisCfg.enabled {
+		return app.store.RevokedTokens.Revoke(ctx, jti, userID, expiry)
+	}
+	return app.cacheStorage.Tokens.Revoke(ctx, jti, time.Until(expiry))
+}
+
+func (app *application) invalidateCachedUser(ctx context.Context, userId int64) {
+	if app.config.redisCfg.enabled {
+		app.cacheStorage.Users.Delete(ctx, userId)
 	}
-	return user.Role.Level >= role.Level, nil
 }
 
 func (app *application) getUser(ctx context.Context, userId int64) (*store.User, error) {
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vadiraj/gopher/internal/auth"
+	"github.com/vadiraj/gopher/internal/store"
+)
+
+const (
+	oidcCookiePath = "/v1/authentication/oidc"
+	oidcLoginExp   = time.Minute * 10
+)
+
+var usernameDisallowed = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// errEmailNotVerified keeps unverified emails from creating accounts that a
+// verified sign in for the same address would later be linked to.
+var errEmailNotVerified = errors.New("provider did not verify the email")
+
+func oidcCookieName(provider string) string {
+	return "oidc_" + provider
+}
+
+// oidcLoginHandler starts the authorization code flow. The state, nonce and
+// PKCE verifier travel in a short lived cookie so the callback can check
+// that it belongs to the browser that started the login.
+func (app *application) oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.oidcProviders[chi.URLParam(r, "provider")]
+	if !ok {
+		app.notFoundError(w, r, fmt.Errorf("unknown oidc provider"))
+		return
+	}
+	state, err := auth.RandomToken(32)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	nonce, err := auth.RandomToken(32)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	verifier, challenge, err := auth.NewPKCE()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	//?mode=cookie asks for a cookie session once the callback succeeds
+	mode := "token"
+	if r.URL.Query().Get("mode") == "cookie" {
+		mode = "cookie"
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookieName(provider.Name()),
+		Value:    strings.Join([]string{state, nonce, verifier, mode}, "."),
+		Path:     oidcCookiePath,
+		MaxAge:   int(oidcLoginExp.Seconds()),
+		HttpOnly: true,
+		Secure:   app.config.env == "production",
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, provider.AuthCodeURL(state, nonce, challenge), http.StatusFound)
+}
+
+// oidcCallbackHandler finishes the flow and signs the user in: an already
+// linked identity wins, then an active user with the same verified email,
+// otherwise a new active user is created. Unverified emails are refused.
+func (app *application) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.oidcProviders[chi.URLParam(r, "provider")]
+	if !ok {
+		app.notFoundError(w, r, fmt.Errorf("unknown oidc provider"))
+		return
+	}
+	cookie, err := r.Cookie(oidcCookieName(provider.Name()))
+	if err != nil {
+		app.badRequestError(w, r, fmt.Errorf("login session not found or expired"))
+		return
+	}
+	//the login attempt is single use whatever happens next
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookie.Name,
+		Path:     oidcCookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   app.config.env == "production",
+		SameSite: http.SameSiteLaxMode,
+	})
+	parts := strings.Split(cookie.Value, ".")
+	if len(parts) != 4 {
+		app.badRequestError(w, r, fmt.Errorf("invalid login session"))
+		return
+	}
+	state, nonce, verifier := parts[0], parts[1], parts[2]
+	if parts[3] == "cookie" {
+		r = withCookieMode(r)
+	}
+	query := r.URL.Query()
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state)) != 1 {
+		app.badRequestError(w, r, fmt.Errorf("state mismatch"))
+		return
+	}
+	if providerErr := query.Get("error"); providerErr != "" {
+		app.unAuthorizedErrorResponse(w, r, fmt.Errorf("sign in was not completed: %s", providerErr))
+		return
+	}
+	code := query.Get("code")
+	if code == "" {
+		app.badRequestError(w, r, fmt.Errorf("missing authorization code"))
+		return
+	}
+	ctx := r.Context()
+	identity, err := provider.Exchange(ctx, code, verifier, nonce)
+	if err != nil {
+		app.unAuthorizedErrorResponse(w, r, err)
+		return
+	}
+	if identity.Email == "" {
+		app.badRequestError(w, r, fmt.Errorf("provider %s did not share an email address", identity.Provider))
+		return
+	}
+	user, err := app.userForIdentity(r, identity)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.unAuthorizedErrorResponse(w, r, fmt.Errorf("account is not active"))
+		case errors.Is(err, store.ErrorInviteCodeInvalid):
+			app.unAuthorizedErrorResponse(w, r, fmt.Errorf("registration is invite only, sign up with an invite code first"))
+		case errors.Is(err, store.ErrorDuplicateEmail):
+			app.conflictResponse(w, r, fmt.Errorf("an account with this email already exists, sign in with your password instead"))
+		case errors.Is(err, errEmailNotVerified):
+			app.forbiddenErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.completeLogin(w, r, user)
+}
+
+func (app *application) userForIdentity(r *http.Request, identity *auth.OIDCIdentity) (*store.User, error) {
+	ctx := r.Context()
+	userID, err := app.store.Identities.GetUserID(ctx, identity.Provider, identity.Subject)
+	if err == nil {
+		return app.store.Users.GetById(ctx, userID)
+	}
+	if !errors.Is(err, store.ErrorNotFound) {
+		return nil, err
+	}
+	//accounts are only created or linked from emails the provider has verified
+	if !identity.EmailVerified {
+		return nil, errEmailNotVerified
+	}
+	user, err := app.store.Users.GetByEmail(ctx, identity.Email)
+	switch {
+	case err == nil:
+		if err := app.store.Identities.Link(ctx, identity.Provider, identity.Subject, user.ID, identity.Email); err != nil {
+			return nil, err
+		}
+		app.logger.Infow("linked oidc identity", "provider", identity.Provider, "user", user.ID)
+		return user, nil
+	case !errors.Is(err, store.ErrorNotFound):
+		return nil, err
+	}
+	//new accounts need an invite code while registration is invite only
+	if app.config.auth.invites.required {
+		return nil, store.ErrorInviteCodeInvalid
+	}
+	user = &store.User{Email: identity.Email}
+	//the account can only be used through the provider until a password is reset
+	password, err := auth.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	if err := user.Password.Set(app.passwordHasher, password); err != nil {
+		return nil, err
+	}
+	base := oidcUsername(identity)
+	user.UserName = base
+	for attempt := 0; ; attempt++ {
+		err := app.store.Identities.CreateUser(ctx, user, identity.Provider, identity.Subject)
+		if !errors.Is(err, store.ErrorDuplicateUsername) || attempt == 3 {
+			return user, err
+		}
+		suffix := make([]byte, 2)
+		if _, err := rand.Read(suffix); err != nil {
+			return nil, err
+		}
+		user.UserName = base + "-" + hex.EncodeToString(suffix)
+	}
+}
+
+// oidcUsername suggests a username from the provider's profile, leaving
+// room for a collision suffix.
+func oidcUsername(identity *auth.OIDCIdentity) string {
+	name := identity.PreferredUsername
+	if name == "" {
+		name, _, _ = strings.Cut(identity.Email, "@")
+	}
+	name = strings.Trim(usernameDisallowed.ReplaceAllString(name, "-"), "-")
+	if name == "" {
+		name = "gopher"
+	}
+	if len(name) > 90 {
+		name = name[:90]
+	}
+	return name
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/vadiraj/gopher/internal/mailer"
+	"github.com/vadiraj/gopher/internal/store"
+)
+
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+type ResetPasswordPayload struct {
+	Token    string `json:"token" validate:"required,max=100"`
+	Password string `json:"password" validate:"required,max=256"`
+}
+
+type ChangePasswordPayload struct {
+	CurrentPassword string `json:"current_password" validate:"required,max=256"`
+	NewPassword     string `json:"new_password" validate:"required,max=256"`
+}
+
+// forgotPasswordHandler always answers 202 so the endpoint cannot be used to
+// find out which emails have an account.
+func (app *application) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payLoad ForgotPasswordPayload
+	if err := readJson(w, r, &payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	ctx := r.Context()
+	user, err := app.store.Users.GetByEmail(ctx, payLoad.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := app.sendPasswordReset(ctx, user); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sendPasswordReset replaces any outstanding reset for the user and mails
+// the new link. A failed email is only logged.
+func (app *application) sendPasswordReset(ctx context.Context, user *store.User) error {
+	plainToken := uuid.New().String()
+	if err := app.store.Users.CreatePasswordReset(ctx, user.ID, hashToken(plainToken), app.config.mail.resetExp); err != nil {
+		return err
+	}
+	isProdEnv := app.config.env == "production"
+	vars := struct {
+		Username  string
+		ResetURL  string
+		ExpiresIn string
+	}{
+		Username:  user.UserName,
+		ResetURL:  fmt.Sprintf("%s/reset-password/%s", app.config.frontendUrl, plainToken),
+		ExpiresIn: app.config.mail.resetExp.String(),
+	}
+	if _, err := app.mailer.Send(mailer.PasswordResetTemplate, user.UserName, user.Email, vars, !isProdEnv); err != nil {
+		app.logger.Errorw("error sending the password reset email", "error", err)
+	}
+	return nil
+}
+
+func (app *application) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payLoad ResetPasswordPayload
+	if err := readJson(w, r, &payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	ctx := r.Context()
+	user, err := app.store.Users.GetByPasswordReset(ctx, payLoad.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if !app.checkPasswordPolicy(w, r, "password", payLoad.Password, user.UserName, user.Email) {
+		return
+	}
+	user, sessionIDs, err := app.store.Users.ResetPassword(ctx, payLoad.Token, payLoad.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := app.revokeSessionTokens(ctx, user.ID, sessionIDs); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	//the cached user still carries the old password hash
+	app.invalidateCachedUser(ctx, user.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// changePasswordHandler replaces the signed in user's password. Every
+// session, the current one included, has to sign in again. Wrong current
+// passwords count against the same lockout as failed logins, so a stolen
+// session cannot be used to guess the password.
+func (app *application) changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payLoad ChangePasswordPayload
+	if err := readJson(w, r, &payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	ctx := r.Context()
+	//the user in the context may come from the cache, which has no password
+	user, err := app.store.Users.GetById(ctx, getUserFromCtx(r).ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	ip := clientIP(r)
+	locked, err := app.loginLockedFor(ctx, user.Email, ip)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if locked > 0 {
+		app.rateLimitExceededResponse(w, r, locked)
+		return
+	}
+	if err := user.Password.Compare(app.passwordHasher, payLoad.CurrentPassword); err != nil {
+		locked, err := app.recordLoginFailure(ctx, user, user.Email, ip)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if locked > 0 {
+			app.rateLimitExceededResponse(w, r, locked)
+			return
+		}
+		app.failedValidationResponse(w, r, map[string][]string{"current_password": {"is incorrect"}})
+		return
+	}
+	if err := app.accountLockout.Reset(ctx, loginAccountKey(user.Email)); err != nil {
+		app.logger.Warnw("could not reset failed login attempts", "error", err)
+	}
+	if !app.checkPasswordPolicy(w, r, "new_password", payLoad.NewPassword, user.UserName, user.Email) {
+		return
+	}
+	if err := user.Password.Set(app.passwordHasher, payLoad.NewPassword); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	sessionIDs, err := app.store.Users.ChangePassword(ctx, user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.revokeSessionTokens(ctx, user.ID, sessionIDs); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.invalidateCachedUser(ctx, user.ID)
+	app.audit(r, "user.password.change", auditTargetUser, strconv.FormatInt(user.ID, 10), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkPasswordPolicy answers with the policy violations for field and
+// returns false when the password is rejected.
+func (app *application) checkPasswordPolicy(w http.ResponseWriter, r *http.Request, field, password string, userInputs ...string) bool {
+	problems, err := app.passwordPolicy.Check(password, userInputs...)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return false
+	}
+	if len(problems) > 0 {
+		app.failedValidationResponse(w, r, map[string][]string{field: problems})
+		return false
+	}
+	return true
+}
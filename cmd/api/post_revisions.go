@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vadiraj/gopher/internal/diff"
+	"github.com/vadiraj/gopher/internal/store"
+)
+
+// PostRevisionDiff shows an earlier version of a post next to what changed
+// between it and the current version.
+type PostRevisionDiff struct {
+	store.PostRevision
+	CurrentVersion int         `json:"current_version"`
+	TitleDiff      []diff.Line `json:"title_diff"`
+	ContentDiff    []diff.Line `json:"content_diff"`
+}
+
+func (app *application) listPostRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	revisions, err := app.store.Posts.GetRevisions(r.Context(), post.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, revisions); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) getPostRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	revision, err := app.store.Posts.GetRevision(r.Context(), post.ID, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	res := PostRevisionDiff{
+		PostRevision:   *revision,
+		CurrentVersion: post.Version,
+		TitleDiff:      diff.Lines(revision.Title, post.Title),
+		ContentDiff:    diff.Lines(revision.Content, post.Content),
+	}
+	if err := app.jsonResponse(w, http.StatusOK, res); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// restorePostRevisionHandler brings back an earlier version as a new one, so
+// the version being replaced stays in the history.
+func (app *application) restorePostRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	from := post.Version
+	if err := app.store.Posts.RestoreRevision(r.Context(), post, version); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.audit(r, "post.restore", auditTargetPost, strconv.FormatInt(post.ID, 10), map[string]any{
+		"restored_version": version,
+		"version":          change{From: from, To: post.Version},
+	})
+	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -3,9 +3,11 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/vadiraj/gopher/internal/store"
@@ -15,15 +17,21 @@ type postKey string
 
 const postCtx postKey = "post"
 
+// CreatePostPayload publishes right away unless Status says otherwise.
+// Scheduled posts need a PublishAt in the future.
 type CreatePostPayload struct {
-	Title   string   `json:"title" validate:"required,max=100"`
-	Content string   `json:"content" validate:"required,max=1000"`
-	Tags    []string `json:"tags"`
+	Title     string     `json:"title" validate:"required,max=100"`
+	Content   string     `json:"content" validate:"required,max=1000"`
+	Tags      []string   `json:"tags"`
+	Status    string     `json:"status" validate:"omitempty,oneof=draft scheduled published"`
+	PublishAt *time.Time `json:"publish_at"`
 }
 
 type UpdatePostPayload struct {
-	Title   *string `json:"title" validate:"omitempty,max=100"`
-	Content *string `json:"content" validate:"omitempty,max=1000"`
+	Title     *string    `json:"title" validate:"omitempty,max=100"`
+	Content   *string    `json:"content" validate:"omitempty,max=1000"`
+	Status    *string    `json:"status" validate:"omitempty,oneof=draft scheduled published"`
+	PublishAt *time.Time `json:"publish_at"`
 }
 
 func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request) {
@@ -44,6 +52,14 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		//todo change after auth
 		UserID: user.ID,
 	}
+	status := payLoad.Status
+	if status == "" {
+		status = store.PostStatusPublished
+	}
+	if err := setPostStatus(post, status, payLoad.PublishAt); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
 	ctx := r.Context()
 	if err := app.store.Posts.Create(ctx, post); err != nil {
 		app.internalServerError(w, r, err)
@@ -58,7 +74,7 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 	post := getPostFromCtx(r)
 	ctx := r.Context()
-	comments, err := app.store.Comments.GetByPostID(ctx, post.ID)
+	comments, err := app.store.Comments.GetByPostID(ctx, post.ID, defaultCommentQuery)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -80,16 +96,58 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 	}
 	if err := Validate.Struct(payLoad); err != nil {
 		app.badRequestError(w, r, err)
+		return
 	}
-	if payLoad.Content != nil {
+	diff := map[string]change{}
+	if payLoad.Content != nil && *payLoad.Content != post.Content {
+		diff["content"] = change{From: post.Content, To: *payLoad.Content}
 		post.Content = *payLoad.Content
 	}
-	if payLoad.Title != nil {
+	if payLoad.Title != nil && *payLoad.Title != post.Title {
+		diff["title"] = change{From: post.Title, To: *payLoad.Title}
 		post.Title = *payLoad.Title
 	}
+	if payLoad.Status != nil || payLoad.PublishAt != nil {
+		status := post.Status
+		if payLoad.Status != nil {
+			status = *payLoad.Status
+		}
+		if post.Status == store.PostStatusPublished && status != store.PostStatusPublished {
+			app.badRequestError(w, r, fmt.Errorf("a published post cannot go back to %s", status))
+			return
+		}
+		from, fromPublishAt := post.Status, post.PublishAt
+		if post.Status != store.PostStatusPublished {
+			if err := setPostStatus(post, status, payLoad.PublishAt); err != nil {
+				app.badRequestError(w, r, err)
+				return
+			}
+		}
+		if from != post.Status {
+			diff["status"] = change{From: from, To: post.Status}
+		}
+		if !sameTime(fromPublishAt, post.PublishAt) {
+			diff["publish_at"] = change{From: fromPublishAt, To: post.PublishAt}
+		}
+	}
+	//nothing changed, so there is no revision or audit entry to write
+	if len(diff) == 0 {
+		if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
 	if err := app.store.Posts.Update(ctx, post); err != nil {
-		app.internalServerError(w, r, err)
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			//the post was edited, published or deleted after it was loaded
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
 	}
+	app.audit(r, "post.update", auditTargetPost, strconv.FormatInt(post.ID, 10), diff)
 	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -102,6 +160,7 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 	postID, err := strconv.ParseInt(idParam, 10, 64)
 	if err != nil {
 		app.internalServerError(w, r, err)
+		return
 	}
 	log.Printf("post id: %d", postID)
 	if err = app.store.Posts.Delete(ctx, postID); err != nil {
@@ -113,6 +172,11 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 		}
 		return
 	}
+	post := getPostFromCtx(r)
+	app.audit(r, "post.delete", auditTargetPost, idParam, map[string]any{
+		"author_id": post.UserID,
+		"title":     post.Title,
+	})
 	w.WriteHeader(http.StatusNoContent)
 }
 func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
@@ -124,7 +188,8 @@ func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 		}
 		log.Printf("id: %v", id)
 		ctx := r.Context()
-		post, err := app.store.Posts.GetById(ctx, id)
+		//unpublished posts only exist for their author
+		post, err := app.store.Posts.GetById(ctx, id, getUserFromCtx(r).ID)
 		if err != nil {
 			switch {
 			case errors.Is(err, store.ErrorNotFound):
@@ -144,3 +209,52 @@ func getPostFromCtx(r *http.Request) *store.Post {
 	post, _ := r.Context().Value(postCtx).(*store.Post)
 	return post
 }
+
+// setPostStatus applies a draft, scheduled or published status. Publishing
+// stamps the current time, scheduling needs a time in the future.
+func setPostStatus(post *store.Post, status string, publishAt *time.Time) error {
+	switch status {
+	case store.PostStatusDraft:
+		post.PublishAt = nil
+	case store.PostStatusScheduled:
+		if publishAt == nil {
+			publishAt = post.PublishAt
+		}
+		if publishAt == nil || !publishAt.After(time.Now()) {
+			return fmt.Errorf("scheduled posts need a publish_at in the future")
+		}
+		post.PublishAt = publishAt
+	case store.PostStatusPublished:
+		now := time.Now()
+		post.PublishAt = &now
+	default:
+		return fmt.Errorf("unknown post status %q", status)
+	}
+	post.Status = status
+	return nil
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// publishScheduledPosts is the publisher job. It keeps going in batches
+// until nothing is due, so a backlog after downtime is cleared in one run.
+func (app *application) publishScheduledPosts(ctx context.Context) error {
+	const batch = 100
+	for {
+		ids, err := app.store.Posts.PublishDue(ctx, batch)
+		if err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			app.logger.Infow("published scheduled posts", "posts", ids)
+		}
+		if len(ids) < batch {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/vadiraj/gopher/internal/store"
+)
+
+// fakePostStore hands out one batch of published ids per PublishDue call.
+type fakePostStore struct {
+	*store.PostStore
+	batches [][]int64
+	err     error
+	limits  []int
+}
+
+func (s *fakePostStore) PublishDue(ctx context.Context, limit int) ([]int64, error) {
+	s.limits = append(s.limits, limit)
+	if len(s.batches) == 0 {
+		return nil, s.err
+	}
+	ids := s.batches[0]
+	s.batches = s.batches[1:]
+	return ids, nil
+}
+
+func batchOfIDs(n int) []int64 {
+	ids := make([]int64, n)
+	for i := range ids {
+		ids[i] = int64(i + 1)
+	}
+	return ids
+}
+
+func TestPublishScheduledPosts(t *testing.T) {
+	app := newTestApplication(t, config{})
+	t.Run("should keep publishing while batches are full", func(t *testing.T) {
+		posts := &fakePostStore{batches: [][]int64{batchOfIDs(100), batchOfIDs(100), batchOfIDs(3)}}
+		app.store.Posts = posts
+		if err := app.publishScheduledPosts(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if len(posts.limits) != 3 {
+			t.Errorf("expected 3 batches and we got %d", len(posts.limits))
+		}
+		for _, limit := range posts.limits {
+			if limit != 100 {
+				t.Errorf("expected a batch limit of 100 and we got %d", limit)
+			}
+		}
+	})
+	t.Run("should stop when nothing is due", func(t *testing.T) {
+		posts := &fakePostStore{}
+		app.store.Posts = posts
+		if err := app.publishScheduledPosts(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if len(posts.limits) != 1 {
+			t.Errorf("expected 1 batch and we got %d", len(posts.limits))
+		}
+	})
+	t.Run("should return the store error", func(t *testing.T) {
+		storeErr := errors.New("database is down")
+		posts := &fakePostStore{batches: [][]int64{batchOfIDs(100)}, err: storeErr}
+		app.store.Posts = posts
+		if err := app.publishScheduledPosts(context.Background()); !errors.Is(err, storeErr) {
+			t.Errorf("expected %v and we got %v", storeErr, err)
+		}
+		if len(posts.limits) != 2 {
+			t.Errorf("expected 2 batches and we got %d", len(posts.limits))
+		}
+	})
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vadiraj/gopher/internal/store"
+)
+
+type AddReactionPayload struct {
+	Kind string `json:"kind" validate:"required,max=32"`
+}
+
+// ReactionList is a page of reactions along with the totals for the target.
+type ReactionList struct {
+	Summary   store.ReactionSummary `json:"summary"`
+	Reactions []store.Reaction      `json:"reactions"`
+}
+
+// reactionRoutes mounts the reaction endpoints for posts or comments. They
+// run below postsContextMiddleware, and commentsContextMiddleware for
+// comments, which load the target.
+func (app *application) reactionRoutes(targetType string) func(chi.Router) {
+	return func(r chi.Router) {
+		r.With(app.RequireScope(scopePostsRead)).Get("/", app.listReactionsHandler(targetType))
+		r.With(app.RequireScope(scopeReactionsWrite)).Post("/", app.addReactionHandler(targetType))
+		r.With(app.RequireScope(scopeReactionsWrite)).Delete("/{kind}", app.removeReactionHandler(targetType))
+	}
+}
+
+func (app *application) listReactionsHandler(targetType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rq := store.PaginatedReactionQuery{
+			Limit:  20,
+			Offset: 0,
+		}
+		rq, err := rq.Parse(r)
+		if err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+		if err := Validate.Struct(rq); err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+		ctx := r.Context()
+		targetID := reactionTargetID(r, targetType)
+		reactions, err := app.store.Reactions.List(ctx, targetType, targetID, rq)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		summaries, err := app.store.Reactions.Summaries(ctx, targetType, []int64{targetID}, getUserFromCtx(r).ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		list := ReactionList{Summary: summaries[targetID], Reactions: reactions}
+		if err := app.jsonResponse(w, http.StatusOK, list); err != nil {
+			app.internalServerError(w, r, err)
+		}
+	}
+}
+
+func (app *application) addReactionHandler(targetType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payLoad AddReactionPayload
+		if err := readJson(w, r, &payLoad); err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+		if err := Validate.Struct(payLoad); err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+		if !slices.Contains(app.config.reactions, payLoad.Kind) {
+			app.failedValidationResponse(w, r, map[string][]string{"kind": {"reaction is not allowed"}})
+			return
+		}
+		user := getUserFromCtx(r)
+		reaction := &store.Reaction{
+			TargetType: targetType,
+			TargetID:   reactionTargetID(r, targetType),
+			UserID:     user.ID,
+			Kind:       payLoad.Kind,
+			User:       store.User{ID: user.ID, UserName: user.UserName},
+		}
+		if err := app.store.Reactions.Add(r.Context(), reaction); err != nil {
+			switch {
+			case errors.Is(err, store.ErrorConflict):
+				app.conflictResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+		if err := app.jsonResponse(w, http.StatusCreated, reaction); err != nil {
+			app.internalServerError(w, r, err)
+		}
+	}
+}
+
+func (app *application) removeReactionHandler(targetType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		kind := chi.URLParam(r, "kind")
+		user := getUserFromCtx(r)
+		if err := app.store.Reactions.Remove(r.Context(), targetType, reactionTargetID(r, targetType), user.ID, kind); err != nil {
+			switch {
+			case errors.Is(err, store.ErrorNotFound):
+				app.notFoundError(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// reactionTargetID is the id of the post or comment loaded by the context
+// middlewares.
+func reactionTargetID(r *http.Request, targetType string) int64 {
+	if targetType == store.ReactionTargetComment {
+		return getCommentFromCtx(r).ID
+	}
+	return getPostFromCtx(r).ID
+}
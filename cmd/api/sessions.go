@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/vadiraj/gopher/internal/store"
+)
+
+// lastSeenTracker collects session activity in memory so authenticated
+// requests do not each write to the database. flushLastSeen stores it in
+// batches.
+type lastSeenTracker struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func newLastSeenTracker() *lastSeenTracker {
+	return &lastSeenTracker{seen: make(map[string]time.Time)}
+}
+
+func (t *lastSeenTracker) touch(sessionID string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seen[sessionID] = at
+}
+
+func (t *lastSeenTracker) touchIfNewer(sessionID string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if at.After(t.seen[sessionID]) {
+		t.seen[sessionID] = at
+	}
+}
+
+// drain hands over everything collected since the last call.
+func (t *lastSeenTracker) drain() map[string]time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	seen := t.seen
+	t.seen = make(map[string]time.Time, len(seen))
+	return seen
+}
+
+// sessionRevocationKey is the revocation list entry that rejects every access
+// token of a session until the last of them has expired.
+func sessionRevocationKey(sessionID string) string {
+	return "session:" + sessionID
+}
+
+func (app *application) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	sessions, err := app.store.Sessions.GetByUser(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	current, _ := getClaimsFromCtx(r)["sid"].(string)
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+	if err := app.jsonResponse(w, http.StatusOK, sessions); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) revokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	sessionID := chi.URLParam(r, "sessionId")
+	if err := app.revokeSession(r.Context(), user.ID, sessionID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.audit(r, "session.revoke", auditTargetSession, sessionID, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeSession ends the session in the database and puts it on the
+// revocation list for as long as its access tokens can live.
+func (app *application) revokeSession(ctx context.Context, userID int64, sessionID string) error {
+	//session ids are uuids, anything else cannot match
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return store.ErrorNotFound
+	}
+	if err := app.store.Sessions.Revoke(ctx, userID, sessionID); err != nil {
+		return err
+	}
+	return app.revokeToken(ctx, sessionRevocationKey(sessionID), userID, time.Now().Add(app.config.auth.token.exp))
+}
+
+// revokeSessionTokens puts sessions that were already ended in the database
+// on the revocation list, so their access tokens stop working right away.
+func (app *application) revokeSessionTokens(ctx context.Context, userID int64, sessionIDs []string) error {
+	expiry := time.Now().Add(app.config.auth.token.exp)
+	for _, id := range sessionIDs {
+		if err := app.revokeToken(ctx, sessionRevocationKey(id), userID, expiry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flushLastSeen writes the collected session activity. Activity that could
+// not be written is put back for the next run.
+func (app *application) flushLastSeen(ctx context.Context) error {
+	seen := app.lastSeen.drain()
+	if err := app.store.Sessions.TouchMany(ctx, seen); err != nil {
+		for id, at := range seen {
+			app.lastSeen.touchIfNewer(id, at)
+		}
+		return err
+	}
+	return nil
+}
+
+// truncate cuts s down to n characters. Invalid UTF-8 is dropped first,
+// Postgres rejects it.
+func truncate(s string, n int) string {
+	s = strings.ToValidUTF8(s, "")
+	count := 0
+	for i := range s {
+		if count == n {
+			return s[:i]
+		}
+		count++
+	}
+	return s
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/vadiraj/gopher/internal/auth"
+	"github.com/vadiraj/gopher/internal/store"
+)
+
+// fakeSessionStore records TouchMany calls and fails them while err is set.
+// during runs while the write is in flight.
+type fakeSessionStore struct {
+	*store.SessionStore
+	err     error
+	during  func()
+	touched map[string]time.Time
+}
+
+func (s *fakeSessionStore) TouchMany(ctx context.Context, lastSeen map[string]time.Time) error {
+	if s.during != nil {
+		s.during()
+	}
+	if s.err != nil {
+		return s.err
+	}
+	s.touched = lastSeen
+	return nil
+}
+
+// fakeRevokedTokenStore keeps the revocation list in memory.
+type fakeRevokedTokenStore struct {
+	*store.RevokedTokenStore
+	revoked map[string]bool
+}
+
+func (s *fakeRevokedTokenStore) Revoke(ctx context.Context, jti string, userID int64, expiry time.Time) error {
+	s.revoked[jti] = true
+	return nil
+}
+
+func (s *fakeRevokedTokenStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	return s.revoked[jti], nil
+}
+
+func TestLastSeenTracker(t *testing.T) {
+	now := time.Now()
+	tracker := newLastSeenTracker()
+	tracker.touch("a", now)
+	tracker.touchIfNewer("a", now.Add(-time.Minute))
+	tracker.touchIfNewer("b", now)
+	seen := tracker.drain()
+	if len(seen) != 2 || !seen["a"].Equal(now) || !seen["b"].Equal(now) {
+		t.Errorf("unexpected activity %v", seen)
+	}
+	if seen := tracker.drain(); len(seen) != 0 {
+		t.Errorf("expected drain to empty the tracker and we got %v", seen)
+	}
+}
+
+func TestFlushLastSeen(t *testing.T) {
+	app := newTestApplication(t, config{})
+	sessions := &fakeSessionStore{err: errors.New("database is down")}
+	app.store.Sessions = sessions
+	now := time.Now()
+	app.lastSeen.touch("a", now)
+	app.lastSeen.touch("b", now)
+	t.Run("should put activity back when the write fails", func(t *testing.T) {
+		//activity seen while the write fails must not be rolled back
+		sessions.during = func() { app.lastSeen.touch("b", now.Add(time.Minute)) }
+		if err := app.flushLastSeen(context.Background()); err == nil {
+			t.Fatal("expected the flush to fail")
+		}
+		seen := app.lastSeen.drain()
+		if !seen["a"].Equal(now) || !seen["b"].Equal(now.Add(time.Minute)) {
+			t.Errorf("unexpected activity %v", seen)
+		}
+	})
+	t.Run("should write and drain activity", func(t *testing.T) {
+		sessions.err, sessions.during = nil, nil
+		app.lastSeen.touch("a", now)
+		if err := app.flushLastSeen(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if !sessions.touched["a"].Equal(now) {
+			t.Errorf("unexpected activity written %v", sessions.touched)
+		}
+		if seen := app.lastSeen.drain(); len(seen) != 0 {
+			t.Errorf("expected no activity left and we got %v", seen)
+		}
+	})
+}
+
+func TestAuthTokenMiddlewareRevokedSession(t *testing.T) {
+	cfg := config{}
+	cfg.auth.token.iss = "gopher"
+	cfg.auth.token.exp = time.Minute
+	app := newTestApplication(t, cfg)
+	app.authenticator = auth.NewJWTAuthenticator("secret", "gopher", "gopher")
+	app.store.RevokedTokens = &fakeRevokedTokenStore{revoked: map[string]bool{}}
+	handler := app.AuthTokenMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	const sessionID = "5f0c3c1e-8a43-4d0e-9c55-3b1b2d0b6f7a"
+	token, err := app.generateAccessToken(1, sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newRequest := func(t *testing.T) *http.Request {
+		req, err := http.NewRequest(http.MethodGet, "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return req
+	}
+	t.Run("should allow tokens of a live session", func(t *testing.T) {
+		rr := execRequest(newRequest(t), handler)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+		if _, ok := app.lastSeen.drain()[sessionID]; !ok {
+			t.Error("expected the session activity to be tracked")
+		}
+	})
+	t.Run("should reject tokens of a revoked session", func(t *testing.T) {
+		if err := app.revokeSessionTokens(context.Background(), 1, []string{sessionID}); err != nil {
+			t.Fatal(err)
+		}
+		rr := execRequest(newRequest(t), handler)
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	})
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"agent", 10, "agent"},
+		{"agent", 3, "age"},
+		{"héllo", 2, "hé"},
+		{"ab\xffcd", 3, "abc"},
+	}
+	for _, test := range tests {
+		if got := truncate(test.in, test.n); got != test.want {
+			t.Errorf("truncate(%q, %d) = %q, expected %q", test.in, test.n, got, test.want)
+		}
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"testing"
 
 	"github.com/vadiraj/gopher/internal/auth"
+	"github.com/vadiraj/gopher/internal/hashing"
+	"github.com/vadiraj/gopher/internal/passwords"
 	"github.com/vadiraj/gopher/internal/store"
 	"github.com/vadiraj/gopher/internal/store/cache"
 	"go.uber.org/zap"
@@ -24,6 +26,11 @@ func newTestApplication(t *testing.T, config config) *application {
 		authenticator: testAuth,
 		cacheStorage:  mockCacheStore,
 		config:        config,
+		lastSeen:      newLastSeenTracker(),
+		passwordPolicy: &passwords.Policy{
+			MinLength: 8,
+		},
+		passwordHasher: hashing.NewArgon2id(hashing.DefaultArgon2idParams),
 	}
 }
 func execRequest(req *http.Request, mux http.Handler) *httptest.ResponseRecorder {
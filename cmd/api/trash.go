@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vadiraj/gopher/internal/store"
+)
+
+// listTrashHandler shows the caller's deleted posts that can still be
+// restored.
+func (app *application) listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	app.listTrash(w, r, getUserFromCtx(r).ID)
+}
+
+// adminListTrashHandler shows the deleted posts of every user, or of the
+// one given by user_id, so they can be restored on the author's behalf.
+func (app *application) adminListTrashHandler(w http.ResponseWriter, r *http.Request) {
+	app.listTrash(w, r, 0)
+}
+
+// listTrash answers with a page of the trash. A non zero userID overrides
+// the user_id parameter.
+func (app *application) listTrash(w http.ResponseWriter, r *http.Request, userID int64) {
+	tq := store.PaginatedTrashQuery{
+		Limit:  20,
+		Offset: 0,
+	}
+	tq, err := tq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if userID != 0 {
+		tq.UserID = userID
+	}
+	if err := Validate.Struct(tq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	posts, err := app.store.Posts.GetTrash(r.Context(), tq, app.config.trash.retention)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// restorePostHandler takes a post back out of the trash. It runs behind
+// deletedPostContextMiddleware and CheckPostOwnership, so owners and users
+// allowed to delete any post can restore it.
+func (app *application) restorePostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	if err := app.store.Posts.Restore(r.Context(), post.ID, app.config.trash.retention); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.audit(r, "post.undelete", auditTargetPost, strconv.FormatInt(post.ID, 10), nil)
+	post.DeletedAt = nil
+	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// deletedPostContextMiddleware is postsContextMiddleware for posts in the
+// trash.
+func (app *application) deletedPostContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "postId"), 10, 64)
+		if err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+		ctx := r.Context()
+		post, err := app.store.Posts.GetDeletedById(ctx, id, app.config.trash.retention)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrorNotFound):
+				app.notFoundError(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+		ctx = context.WithValue(ctx, postCtx, post)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// restoreCommentHandler takes a comment back out of the trash. It runs
+// behind deletedCommentContextMiddleware and CheckCommentOwnership, so
+// authors and users allowed to delete any comment can restore it.
+func (app *application) restoreCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+	if err := app.store.Comments.Restore(r.Context(), comment.ID, app.config.trash.retention); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.audit(r, "comment.undelete", auditTargetComment, strconv.FormatInt(comment.ID, 10), map[string]any{
+		"author_id": comment.UserID,
+		"post_id":   comment.PostID,
+	})
+	comment.Deleted = false
+	if err := app.jsonResponse(w, http.StatusOK, comment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// deletedCommentContextMiddleware is commentsContextMiddleware for comments
+// in the trash.
+func (app *application) deletedCommentContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "commentId"), 10, 64)
+		if err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+		ctx := r.Context()
+		comment, err := app.store.Comments.GetDeletedById(ctx, id, app.config.trash.retention)
+		if err == nil && comment.PostID != getPostFromCtx(r).ID {
+			err = store.ErrorNotFound
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrorNotFound):
+				app.notFoundError(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+		ctx = context.WithValue(ctx, commentCtx, comment)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// purgeTrash hard deletes posts and comments once their retention window has
+// ended.
+func (app *application) purgeTrash(ctx context.Context) error {
+	posts, err := app.store.Posts.Purge(ctx, app.config.trash.retention)
+	if err != nil {
+		return err
+	}
+	comments, err := app.store.Comments.Purge(ctx, app.config.trash.retention)
+	if err != nil {
+		return err
+	}
+	if posts > 0 || comments > 0 {
+		app.logger.Infow("purged trash", "posts", posts, "comments", comments)
+	}
+	return nil
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vadiraj/gopher/internal/auth"
+	"github.com/vadiraj/gopher/internal/store"
+)
+
+const (
+	totpIssuer            = "GopherSocial"
+	recoveryCodeCount     = 10
+	twoFactorChallengeExp = time.Minute * 5
+)
+
+type TwoFactorCodePayload struct {
+	Code string `json:"code" validate:"required,max=20"`
+}
+
+type TwoFactorVerifyPayload struct {
+	Code         string `json:"code" validate:"required_without=RecoveryCode,max=20"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code,max=20"`
+}
+
+type TwoFactorLoginPayload struct {
+	Challenge string `json:"challenge" validate:"required,max=100"`
+	TwoFactorVerifyPayload
+}
+
+type TwoFactorEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	Challenge         string `json:"challenge"`
+	ExpiresIn         int64  `json:"expires_in"`
+}
+
+func (app *application) enrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.store.TwoFactor.Enroll(r.Context(), user.ID, secret); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorConflict):
+			app.conflictResponse(w, r, fmt.Errorf("two-factor authentication is already enabled"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	enrollment := TwoFactorEnrollment{
+		Secret:          secret,
+		ProvisioningURI: auth.TOTPProvisioningURI(totpIssuer, user.Email, secret),
+	}
+	if err := app.jsonResponse(w, http.StatusCreated, enrollment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// confirmTwoFactorHandler turns the enrollment on with the first code from
+// the authenticator app and hands out the recovery codes, which are only
+// ever shown here.
+func (app *application) confirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var payLoad TwoFactorCodePayload
+	if err := readJson(w, r, &payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	user := getUserFromCtx(r)
+	ctx := r.Context()
+	totp, err := app.store.TwoFactor.Get(ctx, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if totp.ConfirmedAt != nil {
+		app.conflictResponse(w, r, fmt.Errorf("two-factor authentication is already enabled"))
+		return
+	}
+	step, ok, err := auth.ValidateTOTP(totp.Secret, payLoad.Code, time.Now(), totp.LastUsedStep)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !ok {
+		app.badRequestError(w, r, fmt.Errorf("invalid code"))
+		return
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.store.TwoFactor.Confirm(ctx, user.ID, step, hashes); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorConflict):
+			app.conflictResponse(w, r, fmt.Errorf("two-factor authentication is already enabled"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.invalidateCachedUser(ctx, user.ID)
+	response := struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{
+		RecoveryCodes: codes,
+	}
+	if err := app.jsonResponse(w, http.StatusOK, response); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) disableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var payLoad TwoFactorVerifyPayload
+	if err := readJson(w, r, &payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	user := getUserFromCtx(r)
+	ctx := r.Context()
+	ok, err := app.verifySecondFactor(ctx, user.ID, payLoad)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !ok {
+		app.unAuthorizedErrorResponse(w, r, fmt.Errorf("invalid code"))
+		return
+	}
+	if err := app.store.TwoFactor.Disable(ctx, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.invalidateCachedUser(ctx, user.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// twoFactorTokenHandler finishes a login that createTokenHandler answered
+// with a challenge.
+func (app *application) twoFactorTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payLoad TwoFactorLoginPayload
+	if err := readJson(w, r, &payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payLoad); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	ctx := r.Context()
+	challenge := hashToken(payLoad.Challenge)
+	userID, err := app.store.TwoFactor.GetChallenge(ctx, challenge)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.unAuthorizedErrorResponse(w, r, fmt.Errorf("invalid or expired challenge"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	ok, err := app.verifySecondFactor(ctx, userID, payLoad.TwoFactorVerifyPayload)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !ok {
+		if err := app.store.TwoFactor.RecordChallengeFailure(ctx, challenge); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		app.unAuthorizedErrorResponse(w, r, fmt.Errorf("invalid code"))
+		return
+	}
+	if err := app.store.TwoFactor.DeleteChallenge(ctx, challenge); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	user, err := app.store.Users.GetById(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.unAuthorizedErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	tokens, err := app.issueTokens(r, user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.auditAs(r, user, "token.issue", auditTargetUser, strconv.FormatInt(user.ID, 10), map[string]any{"two_factor": true})
+	app.writeTokens(w, r, tokens)
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused
+// recovery code, and burns whichever was used.
+func (app *application) verifySecondFactor(ctx context.Context, userID int64, payLoad TwoFactorVerifyPayload) (bool, error) {
+	if payLoad.RecoveryCode != "" {
+		err := app.store.TwoFactor.UseRecoveryCode(ctx, userID, hashToken(normalizeRecoveryCode(payLoad.RecoveryCode)))
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			return false, nil
+		case err != nil:
+			return false, err
+		}
+		return true, nil
+	}
+	totp, err := app.store.TwoFactor.Get(ctx, userID)
+	if err != nil {
+		if errors.Is(err, store.ErrorNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if totp.ConfirmedAt == nil {
+		return false, nil
+	}
+	step, ok, err := auth.ValidateTOTP(totp.Secret, payLoad.Code, time.Now(), totp.LastUsedStep)
+	if err != nil || !ok {
+		return false, err
+	}
+	if err := app.store.TwoFactor.MarkUsed(ctx, userID, step); err != nil {
+		if errors.Is(err, store.ErrorConflict) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (app *application) createTwoFactorChallenge(ctx context.Context, user *store.User) (*TwoFactorChallenge, error) {
+	plainToken := uuid.New().String()
+	if err := app.store.TwoFactor.CreateChallenge(ctx, user.ID, hashToken(plainToken), twoFactorChallengeExp); err != nil {
+		return nil, err
+	}
+	return &TwoFactorChallenge{
+		TwoFactorRequired: true,
+		Challenge:         plainToken,
+		ExpiresIn:         int64(twoFactorChallengeExp.Seconds()),
+	}, nil
+}
+
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := hex.EncodeToString(b)
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashToken(code)
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
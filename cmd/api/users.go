@@ -8,6 +8,7 @@ import (
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/vadiraj/gopher/internal/store"
 )
 
@@ -15,6 +16,10 @@ type userKey string
 
 const userCtx userKey = "user"
 
+type claimsKey string
+
+const claimsCtx claimsKey = "claims"
+
 // GetUser godoc
 // @Summary      Fetches a user profile
 // @Description  Fetches a user profile by id
@@ -96,7 +101,7 @@ func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Reque
 
 func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
 	token := chi.URLParam(r, "token")
-	err := app.store.Users.Activate(r.Context(), token)
+	user, err := app.store.Users.Activate(r.Context(), token)
 	if err != nil {
 		switch err {
 		case store.ErrorNotFound:
@@ -106,6 +111,7 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		}
 		return
 	}
+	app.auditAs(r, user, "user.activate", auditTargetUser, strconv.FormatInt(user.ID, 10), nil)
 	if err := app.jsonResponse(w, http.StatusNoContent, ""); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -139,3 +145,8 @@ func getUserFromCtx(r *http.Request) *store.User {
 	user, _ := r.Context().Value(userCtx).(*store.User)
 	return user
 }
+
+func getClaimsFromCtx(r *http.Request) jwt.MapClaims {
+	claims, _ := r.Context().Value(claimsCtx).(jwt.MapClaims)
+	return claims
+}
@@ -22,6 +22,8 @@ func TestGetUser(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	mockTokenStore := app.cacheStorage.Tokens.(*cache.MockTokenStore)
+	mockTokenStore.On("IsRevoked", mock.Anything, "test-jti").Return(false, nil)
 	t.Run("should not allow unauthenticated requests", func(t *testing.T) {
 		//check for 401 code
 		req, err := http.NewRequest(http.MethodGet, "/v1/users/1", nil)
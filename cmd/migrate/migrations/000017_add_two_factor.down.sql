@@ -0,0 +1,8 @@
+ALTER TABLE IF EXISTS roles
+DROP COLUMN requires_2fa;
+
+DROP TABLE IF EXISTS two_factor_challenges;
+
+DROP TABLE IF EXISTS user_recovery_codes;
+
+DROP TABLE IF EXISTS user_totp;
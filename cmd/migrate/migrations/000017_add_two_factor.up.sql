@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS user_totp(
+    user_id bigint PRIMARY KEY,
+    secret text NOT NULL,
+    last_used_step bigint NOT NULL DEFAULT 0,
+    confirmed_at TIMESTAMP(0) WITH TIME ZONE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes(
+    code bytea PRIMARY KEY,
+    user_id bigint NOT NULL,
+    used_at TIMESTAMP(0) WITH TIME ZONE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_recovery_codes_user_id ON user_recovery_codes (user_id);
+
+CREATE TABLE IF NOT EXISTS two_factor_challenges(
+    token bytea PRIMARY KEY,
+    user_id bigint NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    expiry TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+ALTER TABLE roles
+ADD COLUMN requires_2fa BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS personal_access_tokens(
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    token bytea NOT NULL UNIQUE,
+    scopes VARCHAR(50)[] NOT NULL,
+    expiry TIMESTAMP(0) WITH TIME ZONE,
+    last_used_at TIMESTAMP(0) WITH TIME ZONE,
+    revoked_at TIMESTAMP(0) WITH TIME ZONE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_personal_access_tokens_user_name ON personal_access_tokens (user_id,name) WHERE revoked_at IS NULL;
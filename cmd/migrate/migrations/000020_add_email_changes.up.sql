@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS email_changes(
+    token bytea PRIMARY KEY,
+    cancel_token bytea NOT NULL UNIQUE,
+    user_id bigint NOT NULL,
+    new_email citext NOT NULL,
+    expiry TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_changes_user_id ON email_changes (user_id);
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS permissions(
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL UNIQUE,
+    description TEXT
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions(
+    role_id bigint NOT NULL,
+    permission_id bigint NOT NULL,
+    PRIMARY KEY (role_id,permission_id),
+    FOREIGN KEY (role_id) REFERENCES roles (id) ON DELETE CASCADE,
+    FOREIGN KEY (permission_id) REFERENCES permissions (id) ON DELETE CASCADE
+);
+
+INSERT INTO
+    permissions(name,description)
+VALUES
+    ('posts.update.any','Update posts written by other users'),
+    ('posts.delete.any','Delete posts written by other users'),
+    ('users.ban','Deactivate and reactivate users'),
+    ('users.manage','List users and change their roles')
+ON CONFLICT (name) DO NOTHING;
+
+-- the same rights the role levels used to grant: moderators can update other
+-- user posts, admins can also delete them and manage users
+INSERT INTO role_permissions(role_id,permission_id)
+SELECT r.id,p.id FROM roles r JOIN permissions p ON
+    (r.name='moderator' AND p.name='posts.update.any')
+    OR (r.name='admin' AND p.name IN ('posts.update.any','posts.delete.any','users.ban','users.manage'))
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,7 @@
+DELETE FROM permissions WHERE name='audit.read';
+
+DROP INDEX IF EXISTS idx_audit_logs_action;
+
+DROP TRIGGER IF EXISTS audit_logs_append_only ON audit_logs;
+
+DROP FUNCTION IF EXISTS audit_logs_append_only;
@@ -0,0 +1,23 @@
+CREATE OR REPLACE FUNCTION audit_logs_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_logs is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_logs_append_only ON audit_logs;
+
+CREATE TRIGGER audit_logs_append_only
+    BEFORE UPDATE OR DELETE ON audit_logs
+    FOR EACH ROW EXECUTE FUNCTION audit_logs_append_only();
+
+CREATE INDEX IF NOT EXISTS idx_audit_logs_action ON audit_logs (action);
+
+INSERT INTO
+    permissions(name,description)
+VALUES
+    ('audit.read','Read the audit log')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions(role_id,permission_id)
+SELECT r.id,p.id FROM roles r JOIN permissions p ON r.name='admin' AND p.name='audit.read'
+ON CONFLICT DO NOTHING;
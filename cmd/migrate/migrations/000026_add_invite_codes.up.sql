@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS invite_codes(
+    id bigserial PRIMARY KEY,
+    code citext NOT NULL UNIQUE,
+    created_by bigint,
+    max_uses int NOT NULL DEFAULT 1,
+    uses int NOT NULL DEFAULT 0,
+    expiry TIMESTAMP(0) WITH TIME ZONE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (created_by) REFERENCES users (id) ON DELETE SET NULL,
+    CHECK (uses <= max_uses)
+);
+
+CREATE INDEX IF NOT EXISTS idx_invite_codes_created_by ON invite_codes (created_by);
+
+CREATE TABLE IF NOT EXISTS waitlist(
+    id bigserial PRIMARY KEY,
+    email citext NOT NULL UNIQUE,
+    invite_code_id bigint,
+    invited_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (invite_code_id) REFERENCES invite_codes (id) ON DELETE SET NULL
+);
@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE name IN ('posts.revisions.read','posts.restore.any');
+
+DROP TABLE IF EXISTS post_revisions;
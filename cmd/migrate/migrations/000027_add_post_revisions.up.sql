@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS post_revisions(
+    post_id bigint NOT NULL,
+    version int NOT NULL,
+    title text NOT NULL,
+    content text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (post_id,version),
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+);
+
+INSERT INTO
+    permissions(name,description)
+VALUES
+    ('posts.revisions.read','Read the revision history of posts written by other users'),
+    ('posts.restore.any','Restore earlier revisions of posts written by other users')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions(role_id,permission_id)
+SELECT r.id,p.id FROM roles r JOIN permissions p ON
+    (r.name='moderator' AND p.name='posts.revisions.read')
+    OR (r.name='admin' AND p.name IN ('posts.revisions.read','posts.restore.any'))
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_posts_scheduled;
+
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS posts_status_check;
+
+ALTER TABLE posts DROP COLUMN IF EXISTS publish_at;
+
+ALTER TABLE posts DROP COLUMN IF EXISTS status;
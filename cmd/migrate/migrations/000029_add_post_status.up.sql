@@ -0,0 +1,13 @@
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS status varchar(16) NOT NULL DEFAULT 'published';
+
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS publish_at timestamp(0) with time zone;
+
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS posts_status_check;
+
+ALTER TABLE posts ADD CONSTRAINT posts_status_check CHECK (status IN ('draft','scheduled','published'));
+
+-- every existing post went out when it was created
+UPDATE posts SET publish_at=created_at WHERE publish_at IS NULL AND status='published';
+
+-- what the publisher job scans for
+CREATE INDEX IF NOT EXISTS idx_posts_scheduled ON posts (publish_at) WHERE status='scheduled';
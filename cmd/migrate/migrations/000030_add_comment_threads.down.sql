@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_comments_parent;
+
+DROP INDEX IF EXISTS idx_comments_post_roots;
+
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS fk_comments_parent;
+
+ALTER TABLE comments DROP COLUMN IF EXISTS depth;
+
+ALTER TABLE comments DROP COLUMN IF EXISTS parent_comment_id;
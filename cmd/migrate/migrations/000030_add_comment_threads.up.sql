@@ -0,0 +1,13 @@
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS parent_comment_id bigint;
+
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS depth int NOT NULL DEFAULT 0;
+
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS fk_comments_parent;
+
+-- replies go when their parent is purged, the purge job only removes
+-- comments without replies so this only matters for deleted posts
+ALTER TABLE comments ADD CONSTRAINT fk_comments_parent FOREIGN KEY (parent_comment_id) REFERENCES comments (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_comments_post_roots ON comments (post_id,created_at) WHERE parent_comment_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_comments_parent ON comments (parent_comment_id);
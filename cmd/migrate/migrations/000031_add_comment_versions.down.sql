@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE name='comments.delete.any';
+
+ALTER TABLE comments DROP COLUMN IF EXISTS version;
@@ -0,0 +1,12 @@
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS version int NOT NULL DEFAULT 0;
+
+INSERT INTO
+    permissions(name,description)
+VALUES
+    ('comments.delete.any','Delete comments written by other users')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions(role_id,permission_id)
+SELECT r.id,p.id FROM roles r JOIN permissions p ON
+    r.name IN ('moderator','admin') AND p.name='comments.delete.any'
+ON CONFLICT DO NOTHING;
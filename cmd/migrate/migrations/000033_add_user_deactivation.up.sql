@@ -0,0 +1,7 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deactivated_at timestamp(0) with time zone;
+
+-- inactive users without a pending invitation can only have been
+-- deactivated by an admin, Activate deletes the invitation and the cleanup
+-- job deletes the user along with it
+UPDATE users u SET deactivated_at=NOW()
+WHERE u.is_active=false AND NOT EXISTS(SELECT 1 FROM user_invitations ui WHERE ui.user_id=u.id);
@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS activated_at timestamp(0) with time zone;
+
+-- the activation time was never recorded, creation is the closest we have
+UPDATE users SET activated_at=created_at
+WHERE activated_at IS NULL AND (is_active=true OR deactivated_at IS NOT NULL);
@@ -0,0 +1 @@
+UPDATE roles SET requires_2fa=false WHERE name='admin';
@@ -0,0 +1,3 @@
+-- admins only get their privileges once they have enrolled in 2FA, other
+-- roles can opt in through PUT /v1/admin/roles/{role}/two-factor
+UPDATE roles SET requires_2fa=true WHERE name='admin';
@@ -5,6 +5,7 @@ import (
 
 	"github.com/vadiraj/gopher/internal/db"
 	"github.com/vadiraj/gopher/internal/env"
+	"github.com/vadiraj/gopher/internal/hashing"
 	"github.com/vadiraj/gopher/internal/store"
 )
 
@@ -16,6 +17,6 @@ func main(){
 		log.Fatal(err)
 	}
 	defer conn.Close()
-	store:=store.NewStorage(conn)
+	store:=store.NewStorage(conn,hashing.NewArgon2id(hashing.DefaultArgon2idParams))
 	db.Seed(store,conn)
 }
\ No newline at end of file
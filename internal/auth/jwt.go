@@ -1,15 +1,19 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
 type JWTAuthenticator struct {
-	secret string
-	aud    string
-	iss    string
+	secret     string
+	aud        string
+	iss        string
+	signingKey *Key
+	keys       map[string]*Key
 }
 
 func NewJWTAuthenticator(secret, aud, iss string) *JWTAuthenticator {
@@ -20,7 +24,34 @@ func NewJWTAuthenticator(secret, aud, iss string) *JWTAuthenticator {
 	}
 }
 
+// NewKeyedJWTAuthenticator signs with signingKey and accepts tokens signed by
+// it or by any of verifyKeys, which lets retired keys keep verifying until
+// the tokens they signed have expired.
+func NewKeyedJWTAuthenticator(signingKey *Key, verifyKeys []*Key, aud, iss string) (*JWTAuthenticator, error) {
+	if signingKey == nil || !signingKey.CanSign() {
+		return nil, errors.New("a private signing key is required")
+	}
+	keys := map[string]*Key{signingKey.ID: signingKey}
+	for _, key := range verifyKeys {
+		if existing, ok := keys[key.ID]; ok && existing != key {
+			return nil, fmt.Errorf("duplicate key id %s", key.ID)
+		}
+		keys[key.ID] = key
+	}
+	return &JWTAuthenticator{
+		aud:        aud,
+		iss:        iss,
+		signingKey: signingKey,
+		keys:       keys,
+	}, nil
+}
+
 func (j *JWTAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
+	if j.signingKey != nil {
+		token := jwt.NewWithClaims(j.signingKey.Method, claims)
+		token.Header["kid"] = j.signingKey.ID
+		return token.SignedString(j.signingKey.private)
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString([]byte(j.secret))
 	if err != nil {
@@ -30,6 +61,9 @@ func (j *JWTAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
 }
 
 func (j *JWTAuthenticator) ValidateToken(token string) (*jwt.Token, error) {
+	if j.signingKey != nil {
+		return j.validateKeyed(token)
+	}
 	return jwt.Parse(token, func(t *jwt.Token) (any, error) {
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpectd signing method %v", t.Header["alg"])
@@ -42,3 +76,38 @@ func (j *JWTAuthenticator) ValidateToken(token string) (*jwt.Token, error) {
 		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}),
 	)
 }
+
+func (j *JWTAuthenticator) validateKeyed(token string) (*jwt.Token, error) {
+	return jwt.Parse(token, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := j.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		if t.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpectd signing method %v", t.Header["alg"])
+		}
+		return key.public, nil
+	},
+		jwt.WithExpirationRequired(),
+		jwt.WithAudience(j.aud),
+		jwt.WithIssuer(j.iss),
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+	)
+}
+
+// JWKS publishes the public half of every key tokens are verified with. It
+// is empty when tokens are signed with the shared HMAC secret.
+func (j *JWTAuthenticator) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	if j.signingKey == nil {
+		return set
+	}
+	for _, key := range j.keys {
+		set.Keys = append(set.Keys, key.JWK())
+	}
+	sort.Slice(set.Keys, func(a, b int) bool {
+		return set.Keys[a].Kid < set.Keys[b].Kid
+	})
+	return set
+}
@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newRSAKey(t *testing.T, kid string) *Key {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := LoadKeyFromPEM(kid, writePEM(t, kid+".pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(priv)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newEd25519Key(t *testing.T, kid string) *Key {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := LoadKeyFromPEM(kid, writePEM(t, kid+".pem", "PRIVATE KEY", der))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func claimsFor(aud string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub": int64(42),
+		"aud": aud,
+		"iss": aud,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestKeyedJWTAuthenticator(t *testing.T) {
+	oldKey := newRSAKey(t, "2024-rsa")
+	newKey := newEd25519Key(t, "2025-ed")
+
+	before, err := NewKeyedJWTAuthenticator(oldKey, nil, "test-aud", "test-aud")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := before.GenerateToken(claimsFor("test-aud"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should set the kid header and validate its own tokens", func(t *testing.T) {
+		token, err := before.ValidateToken(oldToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.Header["kid"] != "2024-rsa" || token.Method.Alg() != "RS256" {
+			t.Errorf("unexpected header %v", token.Header)
+		}
+	})
+
+	t.Run("should keep validating tokens from a retired key during rotation", func(t *testing.T) {
+		during, err := NewKeyedJWTAuthenticator(newKey, []*Key{oldKey}, "test-aud", "test-aud")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := during.ValidateToken(oldToken); err != nil {
+			t.Fatalf("expected the old token to validate, got %v", err)
+		}
+		newToken, err := during.GenerateToken(claimsFor("test-aud"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := during.ValidateToken(newToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.Header["kid"] != "2025-ed" || token.Method.Alg() != "EdDSA" {
+			t.Errorf("unexpected header %v", token.Header)
+		}
+		jwks := during.JWKS()
+		if len(jwks.Keys) != 2 {
+			t.Fatalf("expected 2 published keys and got %d", len(jwks.Keys))
+		}
+		if jwks.Keys[0].Kid != "2024-rsa" || jwks.Keys[0].Kty != "RSA" || jwks.Keys[0].N == "" {
+			t.Errorf("unexpected rsa jwk %+v", jwks.Keys[0])
+		}
+		if jwks.Keys[1].Kid != "2025-ed" || jwks.Keys[1].Crv != "Ed25519" || jwks.Keys[1].X == "" {
+			t.Errorf("unexpected ed25519 jwk %+v", jwks.Keys[1])
+		}
+	})
+
+	t.Run("should reject tokens once the key is removed", func(t *testing.T) {
+		after, err := NewKeyedJWTAuthenticator(newKey, nil, "test-aud", "test-aud")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := after.ValidateToken(oldToken); err == nil {
+			t.Error("expected the token signed by the removed key to be rejected")
+		}
+	})
+
+	t.Run("should reject HMAC tokens", func(t *testing.T) {
+		hmacToken, err := NewJWTAuthenticator("secret", "test-aud", "test-aud").GenerateToken(claimsFor("test-aud"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := before.ValidateToken(hmacToken); err == nil {
+			t.Error("expected the HMAC token to be rejected")
+		}
+	})
+
+	t.Run("should require a private signing key", func(t *testing.T) {
+		pub, err := x509.MarshalPKIXPublicKey(newKey.public)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifyOnly, err := LoadKeyFromPEM("public", writePEM(t, "public.pem", "PUBLIC KEY", pub))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewKeyedJWTAuthenticator(verifyOnly, nil, "test-aud", "test-aud"); err == nil {
+			t.Error("expected a public key to be refused as the signing key")
+		}
+	})
+}
@@ -12,6 +12,7 @@ var testClaims = jwt.MapClaims{
 	"aud": "test-aud",
 	"iss": "test-aud",
 	"sub": int64(42),
+	"jti": "test-jti",
 	"exp": time.Now().Add(time.Hour).Unix(),
 }
 
@@ -30,3 +31,7 @@ func (m *TestAuthenticator) ValidateToken(token string) (*jwt.Token, error) {
 		return []byte(secret), nil
 	})
 }
+
+func (m *TestAuthenticator) JWKS() JWKSet {
+	return JWKSet{Keys: []JWK{}}
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockOIDCServer is a minimal provider: discovery, JWKS and a token endpoint
+// that checks the PKCE verifier for the single code it hands out.
+type mockOIDCServer struct {
+	*httptest.Server
+	key           *Key
+	codeChallenge string
+	nonce         string
+	claims        jwt.MapClaims
+}
+
+func newMockOIDCServer(t *testing.T) *mockOIDCServer {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockOIDCServer{
+		key: &Key{ID: "idp-1", Method: jwt.SigningMethodRS256, private: priv, public: &priv.PublicKey},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                m.URL,
+			AuthorizationEndpoint: m.URL + "/authorize",
+			TokenEndpoint:         m.URL + "/token",
+			JWKSURI:               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(JWKSet{Keys: []JWK{m.key.JWK()}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "client" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.PostFormValue("code") != "the-code" || PKCEChallenge(r.PostFormValue("code_verifier")) != m.codeChallenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		claims := jwt.MapClaims{
+			"iss":   m.URL,
+			"aud":   "client",
+			"sub":   "user-123",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": m.nonce,
+		}
+		for k, v := range m.claims {
+			claims[k] = v
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = m.key.ID
+		signed, err := token.SignedString(m.key.private)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "access_token": "at"})
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+func TestOIDCProvider(t *testing.T) {
+	ctx := context.Background()
+	server := newMockOIDCServer(t)
+	provider, err := NewOIDCProvider(ctx, OIDCConfig{
+		Name:         "corp",
+		Issuer:       server.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:8080/v1/authentication/oidc/corp/callback",
+	}, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authorize := func(t *testing.T) (verifier, nonce string) {
+		t.Helper()
+		verifier, challenge, err := NewPKCE()
+		if err != nil {
+			t.Fatal(err)
+		}
+		nonce, _ = RandomToken(16)
+		u, err := url.Parse(provider.AuthCodeURL("state", nonce, challenge))
+		if err != nil {
+			t.Fatal(err)
+		}
+		q := u.Query()
+		if q.Get("code_challenge_method") != "S256" || q.Get("client_id") != "client" || q.Get("scope") != "openid email profile" {
+			t.Fatalf("unexpected authorization url %s", u)
+		}
+		server.codeChallenge = q.Get("code_challenge")
+		server.nonce = q.Get("nonce")
+		return verifier, nonce
+	}
+
+	t.Run("should exchange the code for a verified identity", func(t *testing.T) {
+		server.claims = jwt.MapClaims{"email": "gopher@example.com", "email_verified": true, "preferred_username": "gopher"}
+		verifier, nonce := authorize(t)
+		identity, err := provider.Exchange(ctx, "the-code", verifier, nonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if identity.Subject != "user-123" || identity.Email != "gopher@example.com" || !identity.EmailVerified || identity.Provider != "corp" {
+			t.Errorf("unexpected identity %+v", identity)
+		}
+	})
+
+	t.Run("should reject a wrong code verifier", func(t *testing.T) {
+		_, nonce := authorize(t)
+		if _, err := provider.Exchange(ctx, "the-code", "not-the-verifier", nonce); err == nil {
+			t.Error("expected the exchange to fail")
+		}
+	})
+
+	t.Run("should reject a nonce mismatch", func(t *testing.T) {
+		verifier, _ := authorize(t)
+		if _, err := provider.Exchange(ctx, "the-code", verifier, "other-nonce"); err == nil {
+			t.Error("expected the exchange to fail")
+		}
+	})
+
+	t.Run("should reject tokens for another audience", func(t *testing.T) {
+		server.claims = jwt.MapClaims{"aud": "someone-else"}
+		defer func() { server.claims = nil }()
+		verifier, nonce := authorize(t)
+		if _, err := provider.Exchange(ctx, "the-code", verifier, nonce); err == nil {
+			t.Error("expected the exchange to fail")
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTP(t *testing.T) {
+	//RFC 6238 appendix B, SHA1 seed
+	seed := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+	}
+
+	t.Run("should match the RFC 6238 test vectors", func(t *testing.T) {
+		key := []byte("12345678901234567890")
+		for _, v := range vectors {
+			if got := hotp(key, uint64(v.unix/TOTPPeriod), 8); got != v.code {
+				t.Errorf("at %d expected %s and got %s", v.unix, v.code, got)
+			}
+		}
+	})
+
+	t.Run("should accept the neighbouring steps and refuse replays", func(t *testing.T) {
+		now := time.Unix(1111111111, 0)
+		previous, err := TOTPCode(seed, TOTPStep(now)-1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		step, ok, err := ValidateTOTP(seed, previous, now, 0)
+		if err != nil || !ok || step != TOTPStep(now)-1 {
+			t.Fatalf("expected the previous step to validate, got step=%d ok=%v err=%v", step, ok, err)
+		}
+		if _, ok, _ := ValidateTOTP(seed, previous, now, step); ok {
+			t.Error("expected the code to be refused once its step was used")
+		}
+		stale, _ := TOTPCode(seed, TOTPStep(now)-3)
+		if _, ok, _ := ValidateTOTP(seed, stale, now, 0); ok {
+			t.Error("expected a code outside the skew window to be refused")
+		}
+	})
+
+	t.Run("should build a provisioning uri", func(t *testing.T) {
+		uri := TOTPProvisioningURI("GopherSocial", "gopher@example.com", seed)
+		if !strings.HasPrefix(uri, "otpauth://totp/GopherSocial:gopher@example.com?") || !strings.Contains(uri, "secret="+seed) {
+			t.Errorf("unexpected uri %s", uri)
+		}
+	})
+}
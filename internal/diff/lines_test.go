@@ -0,0 +1,46 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     []Line
+	}{
+		{
+			name: "unchanged",
+			old:  "a\nb",
+			new:  "a\nb",
+			want: []Line{{OpEqual, "a"}, {OpEqual, "b"}},
+		},
+		{
+			name: "changed line",
+			old:  "a\nb\nc",
+			new:  "a\nB\nc",
+			want: []Line{{OpEqual, "a"}, {OpDelete, "b"}, {OpInsert, "B"}, {OpEqual, "c"}},
+		},
+		{
+			name: "appended and removed",
+			old:  "a\nb",
+			new:  "b\nc",
+			want: []Line{{OpDelete, "a"}, {OpEqual, "b"}, {OpInsert, "c"}},
+		},
+		{
+			name: "from empty",
+			old:  "",
+			new:  "a",
+			want: []Line{{OpInsert, "a"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Lines(tt.old, tt.new); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v and got %v", tt.want, got)
+			}
+		})
+	}
+}
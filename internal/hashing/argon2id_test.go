@@ -0,0 +1,79 @@
+package hashing
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testParams = Argon2idParams{
+	Memory:      1024,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func TestArgon2id(t *testing.T) {
+	h := NewArgon2id(testParams)
+	encoded, err := h.Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("unexpected encoding %q", encoded)
+	}
+
+	t.Run("should verify the right password", func(t *testing.T) {
+		needsRehash, err := h.Verify("correct horse battery staple", encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if needsRehash {
+			t.Error("expected no rehash for current parameters")
+		}
+	})
+
+	t.Run("should reject a wrong password", func(t *testing.T) {
+		if _, err := h.Verify("wrong", encoded); !errors.Is(err, ErrMismatch) {
+			t.Errorf("expected ErrMismatch and got %v", err)
+		}
+	})
+
+	t.Run("should ask for a rehash when the parameters get stronger", func(t *testing.T) {
+		stronger := testParams
+		stronger.Iterations = 2
+		needsRehash, err := NewArgon2id(stronger).Verify("correct horse battery staple", encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !needsRehash {
+			t.Error("expected a rehash")
+		}
+	})
+
+	t.Run("should verify bcrypt hashes and ask for a rehash", func(t *testing.T) {
+		legacy, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		needsRehash, err := h.Verify("secret", string(legacy))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !needsRehash {
+			t.Error("expected a rehash for bcrypt")
+		}
+		if _, err := h.Verify("other", string(legacy)); !errors.Is(err, ErrMismatch) {
+			t.Errorf("expected ErrMismatch and got %v", err)
+		}
+	})
+
+	t.Run("should reject unknown formats", func(t *testing.T) {
+		if _, err := h.Verify("secret", "plain"); !errors.Is(err, ErrUnknownFormat) {
+			t.Errorf("expected ErrUnknownFormat and got %v", err)
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package hashing
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrMismatch      = errors.New("password does not match")
+	ErrUnknownFormat = errors.New("unknown password hash format")
+)
+
+// Hasher produces and checks encoded password hashes.
+type Hasher interface {
+	Hash(plain string) (string, error)
+	// Verify returns ErrMismatch when plain does not match encoded.
+	// needsRehash reports that encoded uses an older algorithm or weaker
+	// parameters than the hasher would use today.
+	Verify(plain, encoded string) (needsRehash bool, err error)
+}
+
+// verifyBcrypt keeps hashes created before the switch to argon2id working.
+// They always need a rehash.
+func verifyBcrypt(plain, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(plain))
+	switch {
+	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+		return false, ErrMismatch
+	case err != nil:
+		return false, err
+	}
+	return true, nil
+}
+
+func isBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
@@ -3,9 +3,15 @@ package mailer
 import "embed"
 
 const (
-	FromName            = "gopher-social"
-	maxRetries          = 3
-	UserWelcomeTemplate = "user_invitation.tmpl"
+	FromName                   = "gopher-social"
+	maxRetries                 = 3
+	UserWelcomeTemplate        = "user_invitation.tmpl"
+	PasswordResetTemplate      = "password_reset.tmpl"
+	AccountLockedTemplate      = "account_locked.tmpl"
+	EmailChangeConfirmTemplate = "email_change_confirm.tmpl"
+	EmailChangeNoticeTemplate  = "email_change_notice.tmpl"
+	MagicLinkTemplate          = "magic_link.tmpl"
+	WaitlistInviteTemplate     = "waitlist_invite.tmpl"
 )
 
 //go:embed "template/*"
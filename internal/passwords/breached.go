@@ -0,0 +1,60 @@
+package passwords
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BreachChecker reports whether a password is known to have leaked.
+type BreachChecker interface {
+	Breached(password string) (bool, error)
+}
+
+// RangeDir checks passwords against a local copy of the Have I Been Pwned
+// range files: one file per five character SHA-1 prefix, named
+// <PREFIX>.txt and holding SUFFIX:COUNT lines, as written by the official
+// downloader. Only the file for the password's prefix is read, so the copy
+// can be refreshed offline by replacing the files while the API runs.
+type RangeDir struct {
+	dir string
+}
+
+func NewRangeDir(dir string) (*RangeDir, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, errors.New("breached password list must be a directory of range files")
+	}
+	return &RangeDir{dir: dir}, nil
+}
+
+func (d *RangeDir) Breached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+	f, err := os.Open(filepath.Join(d.dir, prefix+".txt"))
+	if err != nil {
+		//no file means no leaked password shares the prefix
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), ":")
+		if strings.EqualFold(strings.TrimSpace(line), suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,77 @@
+package passwords
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Policy decides whether a new password is acceptable. A nil Breached
+// skips the breached password check.
+type Policy struct {
+	MinLength int
+	//MinScore is the lowest accepted Strength score, from 0 to 4
+	MinScore int
+	Breached BreachChecker
+}
+
+// Check returns the reasons the password is rejected, or nothing when it is
+// accepted. userInputs are values the password must not contain, such as
+// the username and email.
+func (p *Policy) Check(password string, userInputs ...string) ([]string, error) {
+	var problems []string
+	if utf8.RuneCountInString(password) < p.MinLength {
+		problems = append(problems, fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+	lower := strings.ToLower(password)
+	for _, input := range userInputs {
+		for _, part := range personalParts(input) {
+			if strings.Contains(lower, part) {
+				problems = append(problems, "must not contain your username or email")
+				break
+			}
+		}
+	}
+	if Strength(password, userInputs...) < p.MinScore {
+		problems = append(problems, "is too easy to guess")
+	}
+	if p.Breached != nil {
+		breached, err := p.Breached.Breached(password)
+		if err != nil {
+			return nil, err
+		}
+		if breached {
+			problems = append(problems, "has appeared in a data breach, choose another one")
+		}
+	}
+	return dedupe(problems), nil
+}
+
+// personalParts splits an email into its local part and the whole address,
+// ignoring pieces too short to matter.
+func personalParts(input string) []string {
+	input = strings.ToLower(strings.TrimSpace(input))
+	parts := []string{input}
+	if local, _, ok := strings.Cut(input, "@"); ok {
+		parts = append(parts, local)
+	}
+	var out []string
+	for _, part := range parts {
+		if len(part) >= 3 {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func dedupe(problems []string) []string {
+	seen := map[string]bool{}
+	out := problems[:0]
+	for _, p := range problems {
+		if !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	return out
+}
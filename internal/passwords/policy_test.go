@@ -0,0 +1,70 @@
+package passwords
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStrength(t *testing.T) {
+	tests := []struct {
+		password string
+		min, max int
+	}{
+		{password: "aaaaaaaaaaaa", min: 0, max: 0},
+		{password: "password123", min: 0, max: 1},
+		{password: "qwertyuiop", min: 0, max: 1},
+		{password: "Tr0ub4dor&3x", min: 3, max: 4},
+		{password: "correct-horse-battery-staple", min: 4, max: 4},
+	}
+	for _, tt := range tests {
+		if score := Strength(tt.password); score < tt.min || score > tt.max {
+			t.Errorf("%q: expected a score between %d and %d and got %d", tt.password, tt.min, tt.max, score)
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	dir := t.TempDir()
+	sum := sha1.Sum([]byte("leaked-but-long-Passw0rd!"))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	err := os.WriteFile(filepath.Join(dir, hash[:5]+".txt"), []byte("0000000000000000000000000000000000A:1\r\n"+hash[5:]+":42\r\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	breached, err := NewRangeDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := &Policy{MinLength: 10, MinScore: 3, Breached: breached}
+
+	t.Run("should accept a strong password", func(t *testing.T) {
+		problems, err := policy.Check("violet-Anchor-58-drift", "gopher", "gopher@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(problems) != 0 {
+			t.Errorf("expected no problems and got %v", problems)
+		}
+	})
+
+	t.Run("should reject short and personal passwords", func(t *testing.T) {
+		problems, _ := policy.Check("Gopher1", "gopher", "gopher@example.com")
+		if len(problems) < 2 {
+			t.Errorf("expected the length and username problems and got %v", problems)
+		}
+	})
+
+	t.Run("should reject breached passwords", func(t *testing.T) {
+		problems, err := policy.Check("leaked-but-long-Passw0rd!")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(problems) != 1 || !strings.Contains(problems[0], "breach") {
+			t.Errorf("expected only the breach problem and got %v", problems)
+		}
+	})
+}
@@ -0,0 +1,120 @@
+package passwords
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// commonPasswords is a short list of passwords that are guessed first.
+var commonPasswords = []string{
+	"password", "123456", "qwerty", "letmein", "welcome", "admin", "iloveyou",
+	"monkey", "dragon", "football", "baseball", "sunshine", "princess",
+	"abc123", "master", "shadow", "trustno1", "passw0rd", "superman", "login",
+}
+
+// keyboardRows catch walks along the keyboard such as "qwerty" or "asdf".
+var keyboardRows = []string{
+	"`1234567890-=", "qwertyuiop[]", "asdfghjkl;'", "zxcvbnm,./",
+	"abcdefghijklmnopqrstuvwxyz",
+}
+
+// Strength estimates how hard the password is to guess, on the same 0 to 4
+// scale as zxcvbn: 0 is too guessable and 4 is very unguessable. It is a
+// rough estimate built from the character pool and length, with the
+// predictable parts (repeats, sequences, common passwords and the user's
+// own details) counted as a single guess each.
+func Strength(password string, userInputs ...string) int {
+	lower := strings.ToLower(password)
+	for _, input := range userInputs {
+		for _, part := range personalParts(input) {
+			lower = strings.ReplaceAll(lower, part, "\x00")
+		}
+	}
+	for _, common := range commonPasswords {
+		lower = strings.ReplaceAll(lower, common, "\x00")
+	}
+	effective := 0
+	runes := []rune(lower)
+	for i := 0; i < len(runes); i++ {
+		//each predictable run only counts once
+		j := i + 1
+		for j < len(runes) && (runes[j] == runes[i] || isSequence(runes[j-1], runes[j])) {
+			j++
+		}
+		effective++
+		if runes[i] == 0 {
+			//a replaced word is worth a few characters of guessing
+			effective++
+		}
+		i = j - 1
+	}
+	bits := float64(effective) * math.Log2(float64(poolSize(password)))
+	guessesLog10 := bits * math.Log10(2)
+	switch {
+	case guessesLog10 < 3:
+		return 0
+	case guessesLog10 < 6:
+		return 1
+	case guessesLog10 < 8:
+		return 2
+	case guessesLog10 < 10:
+		return 3
+	default:
+		return 4
+	}
+}
+
+func isSequence(a, b rune) bool {
+	if b == a+1 || b == a-1 {
+		return true
+	}
+	for _, row := range keyboardRows {
+		i := strings.IndexRune(row, a)
+		if i < 0 {
+			continue
+		}
+		if (i+1 < len(row) && rune(row[i+1]) == b) || (i > 0 && rune(row[i-1]) == b) {
+			return true
+		}
+	}
+	return false
+}
+
+func poolSize(password string) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r > unicode.MaxASCII:
+			other = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	size := 0
+	if lower {
+		size += 26
+	}
+	if upper {
+		size += 26
+	}
+	if digit {
+		size += 10
+	}
+	if symbol {
+		size += 33
+	}
+	if other {
+		size += 100
+	}
+	if size < 2 {
+		size = 2
+	}
+	return size
+}
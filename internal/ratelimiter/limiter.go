@@ -0,0 +1,18 @@
+package ratelimiter
+
+import (
+	"context"
+	"time"
+)
+
+// Limiter allows Limit requests per key in each fixed Window.
+type Limiter interface {
+	// Allow counts a request for key. When the key is over its limit it
+	// returns false and how long until the window resets.
+	Allow(ctx context.Context, key string) (bool, time.Duration, error)
+}
+
+type LimiterConfig struct {
+	Limit  int
+	Window time.Duration
+}
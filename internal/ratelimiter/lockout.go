@@ -0,0 +1,40 @@
+package ratelimiter
+
+import (
+	"context"
+	"time"
+)
+
+// Lockout counts failed attempts per key. Once MaxAttempts failures happen
+// inside Window the key is locked, for BaseLockout the first time and twice
+// as long for every lockout after that, up to MaxLockout.
+type Lockout interface {
+	// Locked reports how much longer key stays locked, zero when it is not.
+	Locked(ctx context.Context, key string) (time.Duration, error)
+	// Fail records a failed attempt and returns the lockout it triggered,
+	// zero when the key is still below the limit.
+	Fail(ctx context.Context, key string) (time.Duration, error)
+	// Reset forgets the failures recorded for key.
+	Reset(ctx context.Context, key string) error
+}
+
+type Config struct {
+	MaxAttempts int
+	Window      time.Duration
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+}
+
+// lockoutMemory is how long past lockouts keep doubling the next one.
+const lockoutMemory = time.Hour * 24
+
+func (c Config) lockoutFor(previous int) time.Duration {
+	d := c.BaseLockout
+	for i := 0; i < previous && d < c.MaxLockout; i++ {
+		d *= 2
+	}
+	if d > c.MaxLockout {
+		d = c.MaxLockout
+	}
+	return d
+}
@@ -0,0 +1,145 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type lockoutEntry struct {
+	fails         int
+	failsExpire   time.Time
+	lockouts      int
+	lockoutExpire time.Time
+	lockedUntil   time.Time
+}
+
+// MemoryLockout keeps the counters in process. Each API replica counts on its
+// own, which is fine for a single instance and the reason redis is preferred.
+type MemoryLockout struct {
+	cfg     Config
+	mu      sync.Mutex
+	entries map[string]*lockoutEntry
+	ops     int
+	now     func() time.Time
+}
+
+func NewMemoryLockout(cfg Config) *MemoryLockout {
+	return &MemoryLockout{
+		cfg:     cfg,
+		entries: make(map[string]*lockoutEntry),
+		now:     time.Now,
+	}
+}
+
+func (l *MemoryLockout) Locked(ctx context.Context, key string) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.entries[key]
+	if !ok {
+		return 0, nil
+	}
+	if remaining := e.lockedUntil.Sub(l.now()); remaining > 0 {
+		return remaining, nil
+	}
+	return 0, nil
+}
+
+func (l *MemoryLockout) Fail(ctx context.Context, key string) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+	e, ok := l.entries[key]
+	if !ok {
+		e = &lockoutEntry{}
+		l.entries[key] = e
+	}
+	if now.After(e.failsExpire) {
+		e.fails = 0
+		e.failsExpire = now.Add(l.cfg.Window)
+	}
+	if now.After(e.lockoutExpire) {
+		e.lockouts = 0
+	}
+	e.fails++
+	if e.fails < l.cfg.MaxAttempts {
+		return 0, nil
+	}
+	d := l.cfg.lockoutFor(e.lockouts)
+	e.fails = 0
+	e.lockouts++
+	e.lockoutExpire = now.Add(lockoutMemory)
+	e.lockedUntil = now.Add(d)
+	return d, nil
+}
+
+func (l *MemoryLockout) Reset(ctx context.Context, key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.entries[key]; ok {
+		e.fails = 0
+	}
+	return nil
+}
+
+// sweep drops entries that no longer carry any state, every so often, so the
+// map does not grow with every address that ever failed a login.
+func (l *MemoryLockout) sweep(now time.Time) {
+	l.ops++
+	if l.ops%1000 != 0 {
+		return
+	}
+	for key, e := range l.entries {
+		if now.After(e.failsExpire) && now.After(e.lockoutExpire) && now.After(e.lockedUntil) {
+			delete(l.entries, key)
+		}
+	}
+}
+
+type limiterEntry struct {
+	count  int
+	expire time.Time
+}
+
+// MemoryLimiter is the in process Limiter, with the same caveat as
+// MemoryLockout about multiple replicas.
+type MemoryLimiter struct {
+	cfg     LimiterConfig
+	mu      sync.Mutex
+	entries map[string]*limiterEntry
+	ops     int
+	now     func() time.Time
+}
+
+func NewMemoryLimiter(cfg LimiterConfig) *MemoryLimiter {
+	return &MemoryLimiter{
+		cfg:     cfg,
+		entries: make(map[string]*limiterEntry),
+		now:     time.Now,
+	}
+}
+
+func (l *MemoryLimiter) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.ops++
+	if l.ops%1000 == 0 {
+		for k, e := range l.entries {
+			if now.After(e.expire) {
+				delete(l.entries, k)
+			}
+		}
+	}
+	e, ok := l.entries[key]
+	if !ok || now.After(e.expire) {
+		e = &limiterEntry{expire: now.Add(l.cfg.Window)}
+		l.entries[key] = e
+	}
+	e.count++
+	if e.count > l.cfg.Limit {
+		return false, e.expire.Sub(now), nil
+	}
+	return true, 0, nil
+}
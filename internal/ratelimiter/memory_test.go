@@ -0,0 +1,99 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryLockout(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewMemoryLockout(Config{
+		MaxAttempts: 3,
+		Window:      time.Minute * 15,
+		BaseLockout: time.Minute,
+		MaxLockout:  time.Minute * 3,
+	})
+	l.now = func() time.Time { return now }
+
+	failUntilLocked := func(t *testing.T) time.Duration {
+		t.Helper()
+		for i := 0; i < 2; i++ {
+			if d, _ := l.Fail(ctx, "a"); d != 0 {
+				t.Fatalf("expected no lockout on attempt %d and got %v", i+1, d)
+			}
+		}
+		d, _ := l.Fail(ctx, "a")
+		return d
+	}
+
+	t.Run("should lock out after the maximum attempts", func(t *testing.T) {
+		if d := failUntilLocked(t); d != time.Minute {
+			t.Fatalf("expected a 1m lockout and got %v", d)
+		}
+		if d, _ := l.Locked(ctx, "a"); d != time.Minute {
+			t.Errorf("expected the key to be locked for 1m and got %v", d)
+		}
+		if d, _ := l.Locked(ctx, "b"); d != 0 {
+			t.Errorf("expected other keys to be unaffected and got %v", d)
+		}
+	})
+
+	t.Run("should double the lockout up to the maximum", func(t *testing.T) {
+		now = now.Add(time.Minute * 2)
+		if d, _ := l.Locked(ctx, "a"); d != 0 {
+			t.Fatalf("expected the lockout to be over and got %v", d)
+		}
+		if d := failUntilLocked(t); d != time.Minute*2 {
+			t.Fatalf("expected a 2m lockout and got %v", d)
+		}
+		now = now.Add(time.Minute * 3)
+		if d := failUntilLocked(t); d != time.Minute*3 {
+			t.Fatalf("expected the lockout to be capped at 3m and got %v", d)
+		}
+	})
+
+	t.Run("should forget failures on reset", func(t *testing.T) {
+		now = now.Add(time.Minute * 4)
+		l.Fail(ctx, "a")
+		l.Fail(ctx, "a")
+		l.Reset(ctx, "a")
+		if d, _ := l.Fail(ctx, "a"); d != 0 {
+			t.Errorf("expected the reset to clear the failures and got %v", d)
+		}
+	})
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewMemoryLimiter(LimiterConfig{Limit: 2, Window: time.Minute})
+	l.now = func() time.Time { return now }
+
+	t.Run("should allow requests up to the limit", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			if ok, _, _ := l.Allow(ctx, "a"); !ok {
+				t.Fatalf("expected request %d to be allowed", i+1)
+			}
+		}
+		now = now.Add(time.Second * 20)
+		ok, retryAfter, _ := l.Allow(ctx, "a")
+		if ok {
+			t.Fatal("expected the request over the limit to be denied")
+		}
+		if retryAfter != time.Second*40 {
+			t.Errorf("expected to retry after 40s and got %v", retryAfter)
+		}
+		if ok, _, _ := l.Allow(ctx, "b"); !ok {
+			t.Error("expected other keys to be unaffected")
+		}
+	})
+
+	t.Run("should start a new window once the old one ends", func(t *testing.T) {
+		now = now.Add(time.Minute)
+		if ok, _, _ := l.Allow(ctx, "a"); !ok {
+			t.Error("expected the request to be allowed in the new window")
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package ratelimiter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisLockout shares the counters between every API replica.
+type RedisLockout struct {
+	rdb    *redis.Client
+	cfg    Config
+	prefix string
+}
+
+func NewRedisLockout(rdb *redis.Client, prefix string, cfg Config) *RedisLockout {
+	return &RedisLockout{
+		rdb:    rdb,
+		cfg:    cfg,
+		prefix: prefix,
+	}
+}
+
+func (l *RedisLockout) key(kind, key string) string {
+	return fmt.Sprintf("%s-%s-%s", l.prefix, kind, key)
+}
+
+func (l *RedisLockout) Locked(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := l.rdb.PTTL(ctx, l.key("locked", key)).Result()
+	if err != nil {
+		return 0, err
+	}
+	//PTTL answers with a negative duration for missing keys
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+func (l *RedisLockout) Fail(ctx context.Context, key string) (time.Duration, error) {
+	failsKey := l.key("fails", key)
+	pipe := l.rdb.TxPipeline()
+	fails := pipe.Incr(ctx, failsKey)
+	pipe.ExpireNX(ctx, failsKey, l.cfg.Window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	if fails.Val() < int64(l.cfg.MaxAttempts) {
+		return 0, nil
+	}
+	//only the request that reached the limit applies the lockout
+	if fails.Val() > int64(l.cfg.MaxAttempts) {
+		return l.Locked(ctx, key)
+	}
+	countKey := l.key("lockouts", key)
+	lockouts, err := l.rdb.Incr(ctx, countKey).Result()
+	if err != nil {
+		return 0, err
+	}
+	d := l.cfg.lockoutFor(int(lockouts - 1))
+	pipe = l.rdb.TxPipeline()
+	pipe.Expire(ctx, countKey, lockoutMemory)
+	pipe.Set(ctx, l.key("locked", key), 1, d)
+	pipe.Del(ctx, failsKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return d, nil
+}
+
+func (l *RedisLockout) Reset(ctx context.Context, key string) error {
+	return l.rdb.Del(ctx, l.key("fails", key)).Err()
+}
+
+type RedisLimiter struct {
+	rdb    *redis.Client
+	cfg    LimiterConfig
+	prefix string
+}
+
+func NewRedisLimiter(rdb *redis.Client, prefix string, cfg LimiterConfig) *RedisLimiter {
+	return &RedisLimiter{
+		rdb:    rdb,
+		cfg:    cfg,
+		prefix: prefix,
+	}
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	countKey := fmt.Sprintf("%s-%s", l.prefix, key)
+	pipe := l.rdb.TxPipeline()
+	count := pipe.Incr(ctx, countKey)
+	pipe.ExpireNX(ctx, countKey, l.cfg.Window)
+	ttl := pipe.PTTL(ctx, countKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, 0, err
+	}
+	if count.Val() > int64(l.cfg.Limit) {
+		return false, ttl.Val(), nil
+	}
+	return true, 0, nil
+}
@@ -0,0 +1,124 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// AccessToken is a named personal access token. Only the hash of the token
+// is kept, the plain value is shown once when it is created.
+type AccessToken struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Name       string     `json:"name"`
+	Token      string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	Expiry     *time.Time `json:"expiry"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  string     `json:"created_at"`
+}
+
+type AccessTokenStore struct {
+	db *sql.DB
+}
+
+func (s *AccessTokenStore) Create(ctx context.Context, token *AccessToken) error {
+	query := `
+	INSERT INTO personal_access_tokens (user_id,name,token,scopes,expiry)
+	VALUES ($1,$2,$3,$4,$5) RETURNING id,created_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	err := s.db.QueryRowContext(ctx, query, token.UserID, token.Name, token.Token, pq.Array(token.Scopes), token.Expiry).Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrorConflict
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *AccessTokenStore) GetByUser(ctx context.Context, userID int64) ([]AccessToken, error) {
+	query := `
+	SELECT id,user_id,name,scopes,expiry,last_used_at,created_at FROM personal_access_tokens
+	WHERE user_id=$1 AND revoked_at IS NULL
+	ORDER BY created_at DESC
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tokens := []AccessToken{}
+	for rows.Next() {
+		var t AccessToken
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Name, pq.Array(&t.Scopes), &t.Expiry, &t.LastUsedAt, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// GetByToken looks up a live token by its hash. Revoked and expired tokens
+// are reported as ErrorNotFound.
+func (s *AccessTokenStore) GetByToken(ctx context.Context, token string) (*AccessToken, error) {
+	query := `
+	SELECT id,user_id,name,scopes,expiry,last_used_at,created_at FROM personal_access_tokens
+	WHERE token=$1 AND revoked_at IS NULL AND (expiry IS NULL OR expiry>NOW())
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	t := &AccessToken{Token: token}
+	err := s.db.QueryRowContext(ctx, query, token).Scan(&t.ID, &t.UserID, &t.Name, pq.Array(&t.Scopes), &t.Expiry, &t.LastUsedAt, &t.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Touch records a use of the token. It writes at most once a minute per
+// token so busy automation does not turn every request into an update.
+func (s *AccessTokenStore) Touch(ctx context.Context, id int64) error {
+	query := `
+	UPDATE personal_access_tokens SET last_used_at=NOW()
+	WHERE id=$1 AND (last_used_at IS NULL OR last_used_at<NOW()-INTERVAL '1 minute')
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, query, id)
+	return err
+}
+
+func (s *AccessTokenStore) Revoke(ctx context.Context, userID, id int64) error {
+	query := `
+	UPDATE personal_access_tokens SET revoked_at=NOW()
+	WHERE id=$1 AND user_id=$2 AND revoked_at IS NULL
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrorNotFound
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+)
+
+// AuditLog records who did what to which resource. ActorID is nil for
+// actions taken through the break-glass basic auth credentials or by an
+// anonymous caller. Entries are append-only, a trigger rejects updates and
+// deletes.
+type AuditLog struct {
+	ID         int64           `json:"id"`
+	ActorID    *int64          `json:"actor_id"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	RequestID  string          `json:"request_id"`
+	IP         string          `json:"ip"`
+	Diff       json.RawMessage `json:"diff"`
+	CreatedAt  string          `json:"created_at"`
+}
+
+type AuditLogStore struct {
+	db *sql.DB
+}
+
+func (s *AuditLogStore) Create(ctx context.Context, entry *AuditLog) error {
+	query := `
+	INSERT INTO audit_logs (actor_id,action,target_type,target_id,request_id,ip,diff)
+	VALUES ($1,$2,$3,$4,$5,$6,$7) RETURNING id,created_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	var diff any
+	if len(entry.Diff) > 0 {
+		diff = []byte(entry.Diff)
+	}
+	return s.db.QueryRowContext(ctx, query, entry.ActorID, entry.Action, entry.TargetType, entry.TargetID, entry.RequestID, entry.IP, diff).Scan(&entry.ID, &entry.CreatedAt)
+}
+
+func (s *AuditLogStore) List(ctx context.Context, aq AuditLogQuery) ([]AuditLog, error) {
+	query := `
+	SELECT id,actor_id,action,target_type,target_id,request_id,ip,diff,created_at FROM audit_logs
+	WHERE
+	($2=0 OR id<$2) AND
+	($3=0 OR actor_id=$3) AND
+	($4='' OR action=$4) AND
+	($5='' OR target_type=$5) AND
+	($6='' OR target_id=$6) AND
+	($7::timestamptz IS NULL OR created_at>=$7) AND
+	($8::timestamptz IS NULL OR created_at<=$8)
+	ORDER BY id DESC
+	LIMIT $1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, aq.Limit, aq.Cursor, aq.ActorID, aq.Action, aq.TargetType, aq.TargetID, nullString(aq.Since), nullString(aq.Until))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []AuditLog{}
+	for rows.Next() {
+		var entry AuditLog
+		var diff []byte
+		err := rows.Scan(&entry.ID, &entry.ActorID, &entry.Action, &entry.TargetType, &entry.TargetID, &entry.RequestID, &entry.IP, &diff, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entry.Diff = diff
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
@@ -3,6 +3,7 @@ package cache
 import (
 	"context"
 	"log"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 	"github.com/vadiraj/gopher/internal/store"
@@ -11,6 +12,7 @@ import (
 func NewMockStore() Storage{
 	return Storage{
 		Users: &MockUserStore{},
+		Tokens: &MockTokenStore{},
 	}
 }
 
@@ -31,4 +33,18 @@ func (m *MockUserStore) Set(ctx context.Context,user *store.User) error{
 
 func (m *MockUserStore) Delete(ctx context.Context,userId int64){
 	m.Called(ctx,userId)
-}
\ No newline at end of file
+}
+
+type MockTokenStore struct{
+	mock.Mock
+}
+
+func (m *MockTokenStore) Revoke(ctx context.Context,jti string,ttl time.Duration) error{
+	args:=m.Called(ctx,jti,ttl)
+	return args.Error(0)
+}
+
+func (m *MockTokenStore) IsRevoked(ctx context.Context,jti string) (bool,error){
+	args:=m.Called(ctx,jti)
+	return args.Bool(0),args.Error(1)
+}
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/vadiraj/gopher/internal/store"
@@ -13,10 +14,15 @@ type Storage struct{
 		Set(context.Context,*store.User) error
 		Delete(ctx context.Context,userId int64)
 	}
+	Tokens interface{
+		Revoke(ctx context.Context,jti string,ttl time.Duration) error
+		IsRevoked(ctx context.Context,jti string) (bool,error)
+	}
 }
 
 func NewRedisStorage(rdb *redis.Client) *Storage{
 	return &Storage{
 		Users: &UsersStore{rdb: rdb},
+		Tokens: &TokensStore{rdb: rdb},
 	}
 }
\ No newline at end of file
@@ -0,0 +1,32 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type TokensStore struct {
+	rdb *redis.Client
+}
+
+// Revoke keeps the jti on the revocation list until ttl elapses, which callers
+// set to the remaining lifetime of the token.
+func (s *TokensStore) Revoke(ctx context.Context, jti string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+	cacheKey := fmt.Sprintf("revoked-token-%v", jti)
+	return s.rdb.SetEx(ctx, cacheKey, 1, ttl).Err()
+}
+
+func (s *TokensStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	cacheKey := fmt.Sprintf("revoked-token-%v", jti)
+	n, err := s.rdb.Exists(ctx, cacheKey).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
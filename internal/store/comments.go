@@ -3,8 +3,21 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"sort"
+	"time"
 )
 
+// MaxCommentDepth caps how deep reply threads go. A top level comment has
+// depth 0.
+const MaxCommentDepth = 5
+
+// DeletedCommentPlaceholder stands in for the content of a deleted comment
+// that still has replies, so the thread keeps its shape.
+const DeletedCommentPlaceholder = "[deleted]"
+
+var ErrorCommentTooDeep = errors.New("reply is nested too deeply")
+
 type Comment struct {
 	ID        int64  `json:"id"`
 	PostID    int64  `json:"post_id"`
@@ -12,51 +25,270 @@ type Comment struct {
 	Content   string `json:"content"`
 	CreatedAt string `json:"created_at"`
 	UpdatedAt string `json:"updated_at"`
+	Version   int    `json:"version"`
 	User      User   `json:"user"`
+	//ParentID is nil for top level comments
+	ParentID *int64 `json:"parent_comment_id"`
+	Depth    int    `json:"depth"`
+	Deleted  bool   `json:"deleted"`
+	//ReplyCount counts every direct reply, CollapsedReplies the ones left out
+	//of Replies because the requested depth was reached
+	ReplyCount       int       `json:"reply_count"`
+	CollapsedReplies int       `json:"collapsed_replies"`
+	Replies          []Comment `json:"replies"`
 }
 
 type CommentStore struct {
 	db *sql.DB
 }
 
-func (s *CommentStore) GetByPostID(ctx context.Context, postID int64) ([]Comment, error) {
+// GetByPostID returns a page of the post's top level comments, newest first,
+// with their replies down to cq.Depth levels in a single query. Deleted
+// comments only show up, as placeholders, when a reply below them is still
+// there.
+func (s *CommentStore) GetByPostID(ctx context.Context, postID int64, cq PaginatedCommentQuery) ([]Comment, error) {
 	query := `
-		select comments.id,comments.post_id,comments.user_id,comments.content,comments.created_at,users.username,users.id
-		from comments join users on comments.user_id=users.id
-		where comments.post_id=$1
-		order by comments.created_at desc
-		`
+	WITH RECURSIVE kept AS (
+		-- live comments and every ancestor they hang off
+		SELECT id,parent_comment_id FROM comments
+		WHERE post_id=$1 AND deleted_at IS NULL
+		UNION
+		SELECT c.id,c.parent_comment_id FROM comments c JOIN kept k ON c.id=k.parent_comment_id
+	), visible AS (
+		SELECT c.* FROM comments c JOIN kept k ON c.id=k.id
+	), reply_counts AS (
+		SELECT parent_comment_id AS id,COUNT(*) AS replies FROM visible
+		WHERE parent_comment_id IS NOT NULL
+		GROUP BY parent_comment_id
+	), roots AS (
+		SELECT id FROM visible
+		WHERE parent_comment_id IS NULL
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	), tree AS (
+		SELECT v.*, 0 AS level FROM visible v JOIN roots ON v.id=roots.id
+		UNION ALL
+		SELECT v.*, t.level+1 FROM visible v JOIN tree t ON v.parent_comment_id=t.id
+		WHERE t.level<$4
+	)
+	SELECT t.id,t.post_id,t.user_id,t.content,t.created_at,t.updated_at,t.version,t.parent_comment_id,t.depth,
+	t.deleted_at IS NOT NULL,t.level,users.username,users.id,COALESCE(rc.replies,0)
+	FROM tree t JOIN users ON t.user_id=users.id
+	LEFT JOIN reply_counts rc ON rc.id=t.id
+	ORDER BY t.level,t.created_at
+	`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
-	rows, err := s.db.QueryContext(ctx, query, postID)
+	rows, err := s.db.QueryContext(ctx, query, postID, cq.Limit, cq.Offset, cq.Depth)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	comments := []Comment{}
+	var flat []*Comment
+	levels := map[int64]int{}
 	for rows.Next() {
-		var c Comment
-		c.User = User{}
-		err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Content, &c.CreatedAt, &c.User.UserName, &c.User.ID)
+		c := &Comment{}
+		var level int
+		err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Content, &c.CreatedAt, &c.UpdatedAt, &c.Version, &c.ParentID, &c.Depth, &c.Deleted, &level, &c.User.UserName, &c.User.ID, &c.ReplyCount)
 		if err != nil {
 			return nil, err
 		}
-		comments = append(comments, c)
+		if c.Deleted {
+			c.Content = DeletedCommentPlaceholder
+			c.UserID = 0
+			c.User = User{}
+		}
+		if level == cq.Depth {
+			c.CollapsedReplies = c.ReplyCount
+		}
+		levels[c.ID] = level
+		flat = append(flat, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
-	return comments, nil
+	return buildCommentTree(flat, levels), nil
 }
 
+// buildCommentTree nests comments under their parents. flat is ordered by
+// level, so every parent comes before its replies.
+func buildCommentTree(flat []*Comment, levels map[int64]int) []Comment {
+	children := map[int64][]*Comment{}
+	var roots []*Comment
+	for _, c := range flat {
+		if levels[c.ID] == 0 {
+			roots = append(roots, c)
+			continue
+		}
+		children[*c.ParentID] = append(children[*c.ParentID], c)
+	}
+	var attach func(c *Comment) Comment
+	attach = func(c *Comment) Comment {
+		c.Replies = []Comment{}
+		for _, reply := range children[c.ID] {
+			c.Replies = append(c.Replies, attach(reply))
+		}
+		return *c
+	}
+	//roots are shown newest first, replies oldest first
+	sort.SliceStable(roots, func(i, j int) bool { return roots[i].CreatedAt > roots[j].CreatedAt })
+	comments := make([]Comment, 0, len(roots))
+	for _, root := range roots {
+		comments = append(comments, attach(root))
+	}
+	return comments
+}
+
+// Create stores a comment, or a reply when ParentID is set. Replies must
+// belong to the same post and stay within MaxCommentDepth.
 func (s *CommentStore) Create(ctx context.Context, comment *Comment) error {
+	if comment.ParentID == nil {
+		query := `
+		INSERT INTO comments(post_id,user_id,content)
+		values($1,$2,$3)
+		RETURNING id,created_at
+		`
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		return s.db.QueryRowContext(ctx, query, comment.PostID, comment.UserID, comment.Content).Scan(&comment.ID, &comment.CreatedAt)
+	}
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		var parentDepth int
+		query := `SELECT depth FROM comments WHERE id=$1 AND post_id=$2 AND deleted_at IS NULL FOR SHARE`
+		if err := tx.QueryRowContext(ctx, query, *comment.ParentID, comment.PostID).Scan(&parentDepth); err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrorNotFound
+			default:
+				return err
+			}
+		}
+		if parentDepth+1 > MaxCommentDepth {
+			return ErrorCommentTooDeep
+		}
+		comment.Depth = parentDepth + 1
+		query = `
+		INSERT INTO comments(post_id,user_id,content,parent_comment_id,depth)
+		values($1,$2,$3,$4,$5)
+		RETURNING id,created_at
+		`
+		return tx.QueryRowContext(ctx, query, comment.PostID, comment.UserID, comment.Content, comment.ParentID, comment.Depth).Scan(&comment.ID, &comment.CreatedAt)
+	})
+}
+
+// GetById returns a comment that is not in the trash.
+func (s *CommentStore) GetById(ctx context.Context, commentID int64) (*Comment, error) {
 	query := `
-	INSERT INTO comments(post_id,user_id,content)
-	values($1,$2,$3)
-	RETURNING id,created_at
+	SELECT c.id,c.post_id,c.user_id,c.content,c.created_at,c.updated_at,c.version,c.parent_comment_id,c.depth,users.username,users.id
+	FROM comments c JOIN users ON c.user_id=users.id
+	WHERE c.id=$1 AND c.deleted_at IS NULL
 	`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
-	err := s.db.QueryRowContext(ctx, query, comment.PostID, comment.UserID, comment.Content).Scan(&comment.ID, &comment.CreatedAt)
+	c := &Comment{}
+	err := s.db.QueryRowContext(ctx, query, commentID).Scan(&c.ID, &c.PostID, &c.UserID, &c.Content, &c.CreatedAt, &c.UpdatedAt, &c.Version, &c.ParentID, &c.Depth, &c.User.UserName, &c.User.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Update saves the comment's content if nobody changed it since
+// comment.Version was read, see PostStore.Update.
+func (s *CommentStore) Update(ctx context.Context, comment *Comment) error {
+	query := `
+	UPDATE comments
+	SET content=$1,updated_at=NOW(),version=version+1
+	WHERE id=$2 AND version=$3 AND deleted_at IS NULL
+	RETURNING version,updated_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	err := s.db.QueryRowContext(ctx, query, comment.Content, comment.ID, comment.Version).Scan(&comment.Version, &comment.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrorNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete moves the comment to the trash, see PostStore.Delete.
+func (s *CommentStore) Delete(ctx context.Context, commentID int64) error {
+	query := `UPDATE comments SET deleted_at=NOW() WHERE id=$1 AND deleted_at IS NULL`
+	return s.exec(ctx, query, commentID)
+}
+
+// GetDeletedById returns a comment from the trash that is still within the
+// retention window.
+func (s *CommentStore) GetDeletedById(ctx context.Context, commentID int64, retention time.Duration) (*Comment, error) {
+	query := `
+	SELECT c.id,c.post_id,c.user_id,c.content,c.created_at,c.updated_at,c.version,c.parent_comment_id,c.depth,users.username,users.id
+	FROM comments c JOIN users ON c.user_id=users.id
+	WHERE c.id=$1 AND c.deleted_at IS NOT NULL AND c.deleted_at>$2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	c := &Comment{Deleted: true}
+	err := s.db.QueryRowContext(ctx, query, commentID, time.Now().Add(-retention)).Scan(&c.ID, &c.PostID, &c.UserID, &c.Content, &c.CreatedAt, &c.UpdatedAt, &c.Version, &c.ParentID, &c.Depth, &c.User.UserName, &c.User.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (s *CommentStore) Restore(ctx context.Context, commentID int64, retention time.Duration) error {
+	query := `UPDATE comments SET deleted_at=NULL WHERE id=$1 AND deleted_at IS NOT NULL AND deleted_at>$2`
+	return s.exec(ctx, query, commentID, time.Now().Add(-retention))
+}
+
+// Purge hard deletes comments that have been in the trash for longer than
+// the retention window. Comments that still have replies stay as
+// placeholders until their replies are gone.
+func (s *CommentStore) Purge(ctx context.Context, retention time.Duration) (int64, error) {
+	query := `
+	DELETE FROM comments c WHERE c.deleted_at IS NOT NULL AND c.deleted_at<=$1
+	AND NOT EXISTS (SELECT 1 FROM comments r WHERE r.parent_comment_id=c.id)
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// exec runs an update of a single comment, ErrorNotFound means no row
+// matched.
+func (s *CommentStore) exec(ctx context.Context, query string, args ...any) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, args...)
 	if err != nil {
 		return err
 	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrorNotFound
+	}
 	return nil
 }
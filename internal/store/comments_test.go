@@ -0,0 +1,37 @@
+package store
+
+import "testing"
+
+func TestBuildCommentTree(t *testing.T) {
+	parent := func(id int64) *int64 { return &id }
+	//flat comes ordered by level, then by creation time
+	flat := []*Comment{
+		{ID: 1, CreatedAt: "2024-01-01"},
+		{ID: 2, CreatedAt: "2024-01-02"},
+		{ID: 3, CreatedAt: "2024-01-03", ParentID: parent(1)},
+		{ID: 4, CreatedAt: "2024-01-04", ParentID: parent(1)},
+		{ID: 5, CreatedAt: "2024-01-05", ParentID: parent(3)},
+	}
+	levels := map[int64]int{1: 0, 2: 0, 3: 1, 4: 1, 5: 2}
+	tree := buildCommentTree(flat, levels)
+	if len(tree) != 2 || tree[0].ID != 2 || tree[1].ID != 1 {
+		t.Fatalf("expected roots 2,1 newest first and we got %+v", tree)
+	}
+	if tree[0].Replies == nil || len(tree[0].Replies) != 0 {
+		t.Errorf("expected an empty, non nil reply list and we got %v", tree[0].Replies)
+	}
+	replies := tree[1].Replies
+	if len(replies) != 2 || replies[0].ID != 3 || replies[1].ID != 4 {
+		t.Fatalf("expected replies 3,4 oldest first and we got %+v", replies)
+	}
+	if len(replies[0].Replies) != 1 || replies[0].Replies[0].ID != 5 {
+		t.Errorf("expected reply 5 under 3 and we got %+v", replies[0].Replies)
+	}
+}
+
+func TestBuildCommentTreeEmpty(t *testing.T) {
+	tree := buildCommentTree(nil, map[int64]int{})
+	if tree == nil || len(tree) != 0 {
+		t.Errorf("expected an empty, non nil list and we got %v", tree)
+	}
+}
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// IdentityStore links accounts at external OIDC providers to users.
+type IdentityStore struct {
+	db *sql.DB
+}
+
+func (s *IdentityStore) GetUserID(ctx context.Context, provider, subject string) (int64, error) {
+	query := `
+	SELECT user_id FROM user_identities WHERE provider=$1 AND subject=$2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	var userID int64
+	err := s.db.QueryRowContext(ctx, query, provider, subject).Scan(&userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrorNotFound
+		default:
+			return 0, err
+		}
+	}
+	return userID, nil
+}
+
+func (s *IdentityStore) Link(ctx context.Context, provider, subject string, userID int64, email string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.link(ctx, tx, provider, subject, userID, email)
+	})
+}
+
+// CreateUser creates an already active user for an identity the provider
+// has vouched for and links the two in one transaction.
+func (s *IdentityStore) CreateUser(ctx context.Context, user *User, provider, subject string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+		INSERT INTO users(username,email,password,role_id,is_active,activated_at)
+		VALUES($1,$2,$3,(SELECT id from roles WHERE name='user'),true,NOW()) RETURNING id,created_at
+		`
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		err := tx.QueryRowContext(ctx, query, user.UserName, user.Email, user.Password.hash).Scan(&user.ID, &user.CreatedAt)
+		if err != nil {
+			switch {
+			case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+				return ErrorDuplicateEmail
+			case err.Error() == `pq: duplicate key value violates unique constraint "users_username_key"`:
+				return ErrorDuplicateUsername
+			default:
+				return err
+			}
+		}
+		user.IsActive = true
+		return s.link(ctx, tx, provider, subject, user.ID, user.Email)
+	})
+}
+
+func (s *IdentityStore) link(ctx context.Context, tx *sql.Tx, provider, subject string, userID int64, email string) error {
+	query := `
+	INSERT INTO user_identities (provider,subject,user_id,email) VALUES ($1,$2,$3,$4)
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	_, err := tx.ExecContext(ctx, query, provider, subject, userID, email)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrorConflict
+		}
+		return err
+	}
+	return nil
+}
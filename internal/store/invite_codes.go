@@ -0,0 +1,127 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrorInviteCodeInvalid = errors.New("invite code is invalid, expired or used up")
+	ErrorInviteQuota       = errors.New("invite code quota reached")
+)
+
+// InviteCode lets up to MaxUses people register while registration is
+// invite only. CreatedBy is nil for codes minted through break-glass access.
+type InviteCode struct {
+	ID        int64      `json:"id"`
+	Code      string     `json:"code"`
+	CreatedBy *int64     `json:"created_by"`
+	MaxUses   int        `json:"max_uses"`
+	Uses      int        `json:"uses"`
+	Expiry    *time.Time `json:"expiry"`
+	CreatedAt string     `json:"created_at"`
+}
+
+type InviteCodeStore struct {
+	db *sql.DB
+}
+
+// CreateBatch stores codes minted by an admin in one go.
+func (s *InviteCodeStore) CreateBatch(ctx context.Context, codes []*InviteCode) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		for _, code := range codes {
+			if err := createInviteCode(ctx, tx, code); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CreateWithinQuota stores a code for a regular user as long as they have
+// created fewer than quota codes so far.
+func (s *InviteCodeStore) CreateWithinQuota(ctx context.Context, code *InviteCode, quota int) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		//serialises concurrent requests of the same user
+		if _, err := tx.ExecContext(ctx, `SELECT id FROM users WHERE id=$1 FOR UPDATE`, *code.CreatedBy); err != nil {
+			return err
+		}
+		var created int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM invite_codes WHERE created_by=$1`, *code.CreatedBy).Scan(&created); err != nil {
+			return err
+		}
+		if created >= quota {
+			return ErrorInviteQuota
+		}
+		return createInviteCode(ctx, tx, code)
+	})
+}
+
+func (s *InviteCodeStore) GetByCreator(ctx context.Context, userID int64) ([]InviteCode, error) {
+	query := `
+	SELECT id,code,created_by,max_uses,uses,expiry,created_at FROM invite_codes
+	WHERE created_by=$1
+	ORDER BY id DESC
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	codes := []InviteCode{}
+	for rows.Next() {
+		var c InviteCode
+		if err := rows.Scan(&c.ID, &c.Code, &c.CreatedBy, &c.MaxUses, &c.Uses, &c.Expiry, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		codes = append(codes, c)
+	}
+	return codes, rows.Err()
+}
+
+func createInviteCode(ctx context.Context, tx *sql.Tx, code *InviteCode) error {
+	query := `
+	INSERT INTO invite_codes (code,created_by,max_uses,expiry)
+	VALUES ($1,$2,$3,$4) RETURNING id,created_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	err := tx.QueryRowContext(ctx, query, code.Code, code.CreatedBy, code.MaxUses, code.Expiry).Scan(&code.ID, &code.CreatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrorConflict
+		}
+		return err
+	}
+	return nil
+}
+
+// redeemInviteCode uses up one registration of the code.
+func redeemInviteCode(ctx context.Context, tx *sql.Tx, code string) error {
+	query := `
+	UPDATE invite_codes SET uses=uses+1
+	WHERE code=$1 AND uses<max_uses AND (expiry IS NULL OR expiry>NOW())
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	res, err := tx.ExecContext(ctx, query, code)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrorInviteCodeInvalid
+	}
+	return nil
+}
@@ -19,6 +19,10 @@ func (m *MockUserStore) Create(ctx context.Context, tx *sql.Tx, user *User) erro
 	return nil
 }
 
+func (m *MockUserStore) CreateWithInviteCode(ctx context.Context, user *User, inviteCode, token string, invitationExp time.Duration) error {
+	return nil
+}
+
 func (m *MockUserStore) GetById(ctx context.Context, userId int64) (*User, error) {
 	return &User{
 		ID: userId,
@@ -32,8 +36,8 @@ func (m *MockUserStore) CreateAndInvite(ctx context.Context, user *User, token s
 func (m *MockUserStore) createUserInvitation(ctx context.Context, tx *sql.Tx, token string, invitationExp time.Duration, userId int64) error {
 	return nil
 }
-func (m *MockUserStore) Activate(context.Context, string) error {
-	return nil
+func (m *MockUserStore) Activate(context.Context, string) (*User, error) {
+	return &User{}, nil
 }
 
 func (m *MockUserStore) Delete(ctx context.Context, userId int64) error {
@@ -43,3 +47,67 @@ func (m *MockUserStore) Delete(ctx context.Context, userId int64) error {
 func (m *MockUserStore) GetByEmail(ctx context.Context, email string) (*User, error) {
 	return nil, nil
 }
+
+func (m *MockUserStore) CreatePasswordReset(ctx context.Context, userId int64, token string, exp time.Duration) error {
+	return nil
+}
+
+func (m *MockUserStore) ResetPassword(ctx context.Context, token, newPassword string) (*User, []string, error) {
+	return &User{}, nil, nil
+}
+
+func (m *MockUserStore) UpdatePasswordHash(ctx context.Context, user *User) error {
+	return nil
+}
+
+func (m *MockUserStore) GetByPasswordReset(ctx context.Context, token string) (*User, error) {
+	return &User{}, nil
+}
+
+func (m *MockUserStore) ChangePassword(ctx context.Context, user *User) ([]string, error) {
+	return nil, nil
+}
+
+func (m *MockUserStore) CreateMagicLink(ctx context.Context, userId int64, token string, exp time.Duration) error {
+	return nil
+}
+
+func (m *MockUserStore) ConsumeMagicLink(ctx context.Context, token string) (*User, error) {
+	return &User{}, nil
+}
+
+func (m *MockUserStore) ReissueInvitation(ctx context.Context, email, token string, invitationExp time.Duration) (*User, error) {
+	return &User{}, nil
+}
+
+func (m *MockUserStore) DeleteExpiredInvitations(ctx context.Context, grace time.Duration) (int64, error) {
+	return 0, nil
+}
+
+func (m *MockUserStore) CreateEmailChange(ctx context.Context, userId int64, newEmail, token, cancelToken string, exp time.Duration) error {
+	return nil
+}
+
+func (m *MockUserStore) ConfirmEmailChange(ctx context.Context, token string) (*User, error) {
+	return &User{}, nil
+}
+
+func (m *MockUserStore) CancelEmailChange(ctx context.Context, cancelToken string) error {
+	return nil
+}
+
+func (m *MockUserStore) GetByIdAny(ctx context.Context, id int64) (*User, error) {
+	return &User{ID: id}, nil
+}
+
+func (m *MockUserStore) List(ctx context.Context, uq PaginatedUserQuery) ([]User, error) {
+	return []User{}, nil
+}
+
+func (m *MockUserStore) SetRole(ctx context.Context, userId, roleId int64) error {
+	return nil
+}
+
+func (m *MockUserStore) SetActive(ctx context.Context, userId int64, active bool) ([]string, error) {
+	return nil, nil
+}
@@ -2,6 +2,7 @@ package store
 
 import (
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -65,3 +66,177 @@ func parseTime(since string) string {
 	}
 	return t.Format(time.DateTime)
 }
+
+// parseLimitOffset reads the limit and offset parameters shared by the
+// paginated queries. Parameters that are not given keep their defaults.
+func parseLimitOffset(qs url.Values, limit, offset *int) error {
+	if err := parseInt(qs, "limit", limit); err != nil {
+		return err
+	}
+	return parseInt(qs, "offset", offset)
+}
+
+func parseInt(qs url.Values, key string, dst *int) error {
+	v := qs.Get(key)
+	if v == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return err
+	}
+	*dst = n
+	return nil
+}
+
+// PaginatedUserQuery filters the admin user listing.
+type PaginatedUserQuery struct {
+	Limit         int    `json:"limit" validate:"gte=1,lte=100"`
+	Offset        int    `json:"offset" validate:"gte=0"`
+	Role          string `json:"role" validate:"max=255"`
+	IsActive      *bool  `json:"is_active"`
+	CreatedAfter  string `json:"created_after"`
+	CreatedBefore string `json:"created_before"`
+}
+
+func (uq PaginatedUserQuery) Parse(r *http.Request) (PaginatedUserQuery, error) {
+	qs := r.URL.Query()
+	if err := parseLimitOffset(qs, &uq.Limit, &uq.Offset); err != nil {
+		return uq, err
+	}
+	uq.Role = qs.Get("role")
+	if isActive := qs.Get("is_active"); isActive != "" {
+		active, err := strconv.ParseBool(isActive)
+		if err != nil {
+			return uq, err
+		}
+		uq.IsActive = &active
+	}
+	if after := qs.Get("created_after"); after != "" {
+		uq.CreatedAfter = parseTime(after)
+	}
+	if before := qs.Get("created_before"); before != "" {
+		uq.CreatedBefore = parseTime(before)
+	}
+	return uq, nil
+}
+
+// AuditLogQuery pages through the audit log newest first. Cursor is the id
+// of the last entry of the previous page.
+type AuditLogQuery struct {
+	Limit      int    `json:"limit" validate:"gte=1,lte=100"`
+	Cursor     int64  `json:"cursor" validate:"gte=0"`
+	ActorID    int64  `json:"actor_id" validate:"gte=0"`
+	Action     string `json:"action" validate:"max=100"`
+	TargetType string `json:"target_type" validate:"max=50"`
+	TargetID   string `json:"target_id" validate:"max=100"`
+	Since      string `json:"since"`
+	Until      string `json:"until"`
+}
+
+func (aq AuditLogQuery) Parse(r *http.Request) (AuditLogQuery, error) {
+	qs := r.URL.Query()
+	if err := parseInt(qs, "limit", &aq.Limit); err != nil {
+		return aq, err
+	}
+	if cursor := qs.Get("cursor"); cursor != "" {
+		c, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil {
+			return aq, err
+		}
+		aq.Cursor = c
+	}
+	if actor := qs.Get("actor_id"); actor != "" {
+		a, err := strconv.ParseInt(actor, 10, 64)
+		if err != nil {
+			return aq, err
+		}
+		aq.ActorID = a
+	}
+	aq.Action = qs.Get("action")
+	aq.TargetType = qs.Get("target_type")
+	aq.TargetID = qs.Get("target_id")
+	if since := qs.Get("since"); since != "" {
+		aq.Since = parseTime(since)
+	}
+	if until := qs.Get("until"); until != "" {
+		aq.Until = parseTime(until)
+	}
+	return aq, nil
+}
+
+// PaginatedWaitlistQuery pages through the waitlist oldest first. Status is
+// pending, invited or empty for both.
+type PaginatedWaitlistQuery struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=100"`
+	Offset int    `json:"offset" validate:"gte=0"`
+	Status string `json:"status" validate:"omitempty,oneof=pending invited"`
+}
+
+func (wq PaginatedWaitlistQuery) Parse(r *http.Request) (PaginatedWaitlistQuery, error) {
+	qs := r.URL.Query()
+	if err := parseLimitOffset(qs, &wq.Limit, &wq.Offset); err != nil {
+		return wq, err
+	}
+	wq.Status = qs.Get("status")
+	return wq, nil
+}
+
+// PaginatedTrashQuery pages through deleted posts, most recently deleted
+// first. UserID 0 covers the posts of every user.
+type PaginatedTrashQuery struct {
+	Limit  int   `json:"limit" validate:"gte=1,lte=100"`
+	Offset int   `json:"offset" validate:"gte=0"`
+	UserID int64 `json:"user_id" validate:"gte=0"`
+}
+
+func (tq PaginatedTrashQuery) Parse(r *http.Request) (PaginatedTrashQuery, error) {
+	qs := r.URL.Query()
+	if err := parseLimitOffset(qs, &tq.Limit, &tq.Offset); err != nil {
+		return tq, err
+	}
+	if user := qs.Get("user_id"); user != "" {
+		id, err := strconv.ParseInt(user, 10, 64)
+		if err != nil {
+			return tq, err
+		}
+		tq.UserID = id
+	}
+	return tq, nil
+}
+
+// PaginatedCommentQuery pages through the top level comments of a post.
+// Depth is how many levels of replies are loaded below them.
+type PaginatedCommentQuery struct {
+	Limit  int `json:"limit" validate:"gte=1,lte=50"`
+	Offset int `json:"offset" validate:"gte=0"`
+	Depth  int `json:"depth" validate:"gte=0,lte=5"`
+}
+
+func (cq PaginatedCommentQuery) Parse(r *http.Request) (PaginatedCommentQuery, error) {
+	qs := r.URL.Query()
+	if err := parseLimitOffset(qs, &cq.Limit, &cq.Offset); err != nil {
+		return cq, err
+	}
+	if err := parseInt(qs, "depth", &cq.Depth); err != nil {
+		return cq, err
+	}
+	return cq, nil
+}
+
+// PaginatedReactionQuery pages through the reactions to a post or comment,
+// optionally only those of one kind.
+type PaginatedReactionQuery struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=100"`
+	Offset int    `json:"offset" validate:"gte=0"`
+	Kind   string `json:"kind" validate:"max=32"`
+}
+
+func (rq PaginatedReactionQuery) Parse(r *http.Request) (PaginatedReactionQuery, error) {
+	qs := r.URL.Query()
+	if err := parseLimitOffset(qs, &rq.Limit, &rq.Offset); err != nil {
+		return rq, err
+	}
+	rq.Kind = qs.Get("kind")
+	return rq, nil
+}
@@ -5,21 +5,47 @@ import (
 	"database/sql"
 	"errors"
 	"log"
+	"time"
 
 	"github.com/lib/pq"
 )
 
+// Post statuses. Only published posts are visible to anyone but the
+// author, scheduled ones are published by the publisher job once PublishAt
+// has passed.
+const (
+	PostStatusDraft     = "draft"
+	PostStatusScheduled = "scheduled"
+	PostStatusPublished = "published"
+)
+
 type Post struct {
-	ID        int64     `json:"id"`
-	Content   string    `json:"content"`
-	Title     string    `json:"title"`
-	UserID    int64     `json:"user_id"`
-	Tags      []string  `json:"tags"`
-	CreatedAt string    `json:"created_at"`
-	UpdatedAt string    `json:"updated_at"`
-	Version   int       `json:"version"`
-	Comments  []Comment `json:"comments"`
-	User      User      `json:"user"`
+	ID        int64    `json:"id"`
+	Content   string   `json:"content"`
+	Title     string   `json:"title"`
+	UserID    int64    `json:"user_id"`
+	Tags      []string `json:"tags"`
+	CreatedAt string   `json:"created_at"`
+	UpdatedAt string   `json:"updated_at"`
+	Version   int      `json:"version"`
+	Status    string   `json:"status"`
+	//PublishAt is when a scheduled post goes out, or went out once published
+	PublishAt *time.Time `json:"publish_at"`
+	//DeletedAt is only set on posts in the trash
+	DeletedAt *time.Time      `json:"deleted_at,omitempty"`
+	Comments  []Comment       `json:"comments"`
+	User      User            `json:"user"`
+	Reactions ReactionSummary `json:"reactions"`
+}
+
+// PostRevision is a version of a post that has since been edited.
+// CreatedAt is when it was replaced.
+type PostRevision struct {
+	PostID    int64  `json:"post_id"`
+	Version   int    `json:"version"`
+	Title     string `json:"title"`
+	Content   string `json:"content"`
+	CreatedAt string `json:"created_at"`
 }
 
 type PostWithMetadata struct {
@@ -31,28 +57,38 @@ type PostStore struct {
 	db *sql.DB
 }
 
+// Create stores the post. Posts without a status, such as seeded ones, are
+// published right away.
 func (s *PostStore) Create(ctx context.Context, post *Post) error {
+	if post.Status == "" {
+		now := time.Now()
+		post.Status = PostStatusPublished
+		post.PublishAt = &now
+	}
 	query := `
-	INSERT INTO posts (content,title,user_id,tags)
-	VALUES ($1,$2,$3,$4) RETURNING id,created_at,updated_at
+	INSERT INTO posts (content,title,user_id,tags,status,publish_at)
+	VALUES ($1,$2,$3,$4,$5,$6) RETURNING id,created_at,updated_at
 	`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
-	err := s.db.QueryRowContext(ctx, query, post.Content, post.Title, post.UserID, pq.Array(post.Tags)).Scan(&post.ID, &post.CreatedAt, &post.UpdatedAt)
+	err := s.db.QueryRowContext(ctx, query, post.Content, post.Title, post.UserID, pq.Array(post.Tags), post.Status, post.PublishAt).Scan(&post.ID, &post.CreatedAt, &post.UpdatedAt)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s *PostStore) GetById(ctx context.Context, postID int64) (*Post, error) {
+// GetById returns the post if viewerID may see it: published posts are
+// visible to everyone, drafts and scheduled posts only to their author.
+func (s *PostStore) GetById(ctx context.Context, postID, viewerID int64) (*Post, error) {
 	query := `
-	SELECT id,title,user_id,content,tags,created_at,updated_at,version FROM posts where id=$1
+	SELECT id,title,user_id,content,tags,created_at,updated_at,version,status,publish_at FROM posts
+	where id=$1 AND deleted_at IS NULL AND (status='published' OR user_id=$2)
 	`
 	var post Post
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
-	err := s.db.QueryRowContext(ctx, query, postID).Scan(&post.ID, &post.Title, &post.UserID, &post.Content, pq.Array(&post.Tags), &post.CreatedAt, &post.UpdatedAt, &post.Version)
+	err := s.db.QueryRowContext(ctx, query, postID, viewerID).Scan(&post.ID, &post.Title, &post.UserID, &post.Content, pq.Array(&post.Tags), &post.CreatedAt, &post.UpdatedAt, &post.Version, &post.Status, &post.PublishAt)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -62,12 +98,19 @@ func (s *PostStore) GetById(ctx context.Context, postID int64) (*Post, error) {
 		}
 	}
 	log.Printf("post: %v", post)
-	return &post, err
+	summaries, err := reactionSummaries(ctx, s.db, ReactionTargetPost, []int64{post.ID}, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	post.Reactions = summaries[post.ID]
+	return &post, nil
 }
 
+// Delete moves the post to the trash. It can be restored until the
+// retention window ends and Purge removes it for good.
 func (s *PostStore) Delete(ctx context.Context, postID int64) error {
 	query := `
-	DELETE FROM posts WHERE id=$1
+	UPDATE posts SET deleted_at=NOW() WHERE id=$1 AND deleted_at IS NULL
 	`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
@@ -85,16 +128,184 @@ func (s *PostStore) Delete(ctx context.Context, postID int64) error {
 	return nil
 }
 
+// GetDeletedById returns a post from the trash that is still within the
+// retention window.
+func (s *PostStore) GetDeletedById(ctx context.Context, postID int64, retention time.Duration) (*Post, error) {
+	query := `
+	SELECT id,title,user_id,content,tags,created_at,updated_at,version,status,publish_at,deleted_at FROM posts
+	WHERE id=$1 AND deleted_at IS NOT NULL AND deleted_at>$2
+	`
+	var post Post
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	err := s.db.QueryRowContext(ctx, query, postID, time.Now().Add(-retention)).Scan(&post.ID, &post.Title, &post.UserID, &post.Content, pq.Array(&post.Tags), &post.CreatedAt, &post.UpdatedAt, &post.Version, &post.Status, &post.PublishAt, &post.DeletedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &post, nil
+}
+
+// GetTrash lists deleted posts that can still be restored, most recently
+// deleted first.
+func (s *PostStore) GetTrash(ctx context.Context, tq PaginatedTrashQuery, retention time.Duration) ([]Post, error) {
+	query := `
+	SELECT id,title,user_id,content,tags,created_at,updated_at,version,status,publish_at,deleted_at FROM posts
+	WHERE ($1=0 OR user_id=$1) AND deleted_at IS NOT NULL AND deleted_at>$2
+	ORDER BY deleted_at DESC,id DESC
+	LIMIT $3 OFFSET $4
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, tq.UserID, time.Now().Add(-retention), tq.Limit, tq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	posts := []Post{}
+	for rows.Next() {
+		var post Post
+		if err := rows.Scan(&post.ID, &post.Title, &post.UserID, &post.Content, pq.Array(&post.Tags), &post.CreatedAt, &post.UpdatedAt, &post.Version, &post.Status, &post.PublishAt, &post.DeletedAt); err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+func (s *PostStore) Restore(ctx context.Context, postID int64, retention time.Duration) error {
+	query := `UPDATE posts SET deleted_at=NULL WHERE id=$1 AND deleted_at IS NOT NULL AND deleted_at>$2`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, postID, time.Now().Add(-retention))
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrorNotFound
+	}
+	return nil
+}
+
+// Purge hard deletes posts that have been in the trash for longer than the
+// retention window, together with their comments and revisions.
+func (s *PostStore) Purge(ctx context.Context, retention time.Duration) (int64, error) {
+	query := `DELETE FROM posts WHERE deleted_at IS NOT NULL AND deleted_at<=$1`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Update saves the post if nobody changed it since post.Version was read.
+// The version it replaces is kept in post_revisions.
 func (s *PostStore) Update(ctx context.Context, post *Post) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.update(ctx, tx, post)
+	})
+}
+
+// GetRevisions lists the earlier versions of a post, newest first.
+func (s *PostStore) GetRevisions(ctx context.Context, postID int64) ([]PostRevision, error) {
 	query := `
-	UPDATE posts
-	SET title=$1,content=$2,version=version+1
-	WHERE id=$3 AND version=$4
-	RETURNING version
+	SELECT post_id,version,title,content,created_at FROM post_revisions
+	WHERE post_id=$1
+	ORDER BY version DESC
 	`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
-	err := s.db.QueryRowContext(ctx, query, post.Title, post.Content, post.ID, post.Version).Scan(&post.Version)
+	rows, err := s.db.QueryContext(ctx, query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	revisions := []PostRevision{}
+	for rows.Next() {
+		var rev PostRevision
+		if err := rows.Scan(&rev.PostID, &rev.Version, &rev.Title, &rev.Content, &rev.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+func (s *PostStore) GetRevision(ctx context.Context, postID int64, version int) (*PostRevision, error) {
+	query := `
+	SELECT post_id,version,title,content,created_at FROM post_revisions
+	WHERE post_id=$1 AND version=$2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	var rev PostRevision
+	err := s.db.QueryRowContext(ctx, query, postID, version).Scan(&rev.PostID, &rev.Version, &rev.Title, &rev.Content, &rev.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &rev, nil
+}
+
+// RestoreRevision makes an earlier version the current one. Like any other
+// update it creates a new version and keeps the one it replaces.
+func (s *PostStore) RestoreRevision(ctx context.Context, post *Post, version int) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `SELECT title,content FROM post_revisions WHERE post_id=$1 AND version=$2`
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		var title, content string
+		if err := tx.QueryRowContext(ctx, query, post.ID, version).Scan(&title, &content); err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrorNotFound
+			default:
+				return err
+			}
+		}
+		post.Title = title
+		post.Content = content
+		return s.update(ctx, tx, post)
+	})
+}
+
+func (s *PostStore) update(ctx context.Context, tx *sql.Tx, post *Post) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	query := `
+	INSERT INTO post_revisions (post_id,version,title,content)
+	SELECT id,version,title,content FROM posts WHERE id=$1 AND version=$2
+	`
+	res, err := tx.ExecContext(ctx, query, post.ID, post.Version)
+	if err != nil {
+		return err
+	}
+	if rows, err := res.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return ErrorNotFound
+	}
+	query = `
+	UPDATE posts
+	SET title=$1,content=$2,status=$3,publish_at=$4,version=version+1
+	WHERE id=$5 AND version=$6
+	RETURNING version
+	`
+	err = tx.QueryRowContext(ctx, query, post.Title, post.Content, post.Status, post.PublishAt, post.ID, post.Version).Scan(&post.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -106,18 +317,55 @@ func (s *PostStore) Update(ctx context.Context, post *Post) error {
 	return nil
 }
 
+// PublishDue publishes up to limit scheduled posts whose time has come and
+// returns their ids. Rows are locked with SKIP LOCKED and the status is
+// checked again under the lock, so replicas running the publisher at the
+// same time never publish a post twice. The version is bumped so an edit
+// made from the scheduled copy fails instead of scheduling the post again.
+func (s *PostStore) PublishDue(ctx context.Context, limit int) ([]int64, error) {
+	query := `
+	UPDATE posts SET status='published',version=version+1
+	WHERE id IN (
+		SELECT id FROM posts
+		WHERE status='scheduled' AND publish_at<=NOW() AND deleted_at IS NULL
+		ORDER BY publish_at
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	) AND status='scheduled'
+	RETURNING id
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
 func (s *PostStore) GetUserFeed(ctx context.Context, userId int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
 	query := `
-	select p.id,p.user_id,p.title,p.content,p.created_at,p.version,p.tags,u.username,count(c.id) as comments_count from posts p
-	left join comments c on c.post_id=p.id
+	select p.id,p.user_id,p.title,p.content,p.created_at,p.version,p.tags,p.status,p.publish_at,u.username,count(c.id) as comments_count from posts p
+	left join comments c on c.post_id=p.id and c.deleted_at is null
 	left join users u on p.user_id=u.id
 	join followers f on f.follower_id=p.user_id or p.user_id=$1  
 	where 
 	f.user_id=$1 and
+	p.deleted_at is null and
+	(p.status='published' or p.user_id=$1) and
 	(p.title ilike '%' || $4 || '%' or p.content ilike '%' || $4 || '%') and
 	(p.tags @> $5 or $5 = '{}')
 	group by p.id,u.username
-	order by p.created_at ` + fq.Sort + `
+	order by coalesce(p.publish_at,p.created_at) ` + fq.Sort + `
 	LIMIT $2 OFFSET $3
 	`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -138,6 +386,8 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userId int64, fq PaginatedF
 			&post.CreatedAt,
 			&post.Version,
 			pq.Array(&post.Tags),
+			&post.Status,
+			&post.PublishAt,
 			&post.User.UserName,
 			&post.CommentCount,
 		)
@@ -146,5 +396,20 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userId int64, fq PaginatedF
 			return nil, err
 		}
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	//reactions for the whole page are loaded in one query
+	ids := make([]int64, len(feed))
+	for i := range feed {
+		ids[i] = feed[i].ID
+	}
+	summaries, err := reactionSummaries(ctx, s.db, ReactionTargetPost, ids, userId)
+	if err != nil {
+		return nil, err
+	}
+	for i := range feed {
+		feed[i].Reactions = summaries[feed[i].ID]
+	}
 	return feed, nil
 }
@@ -0,0 +1,174 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// Things users can react to.
+const (
+	ReactionTargetPost    = "post"
+	ReactionTargetComment = "comment"
+)
+
+// reactionTables maps a reaction target to its table and the column holding
+// the target's id. Queries are only ever built from these values.
+var reactionTables = map[string]struct{ table, column string }{
+	ReactionTargetPost:    {"post_reactions", "post_id"},
+	ReactionTargetComment: {"comment_reactions", "comment_id"},
+}
+
+// Reaction is one user's reaction of a given kind to a post or comment. A
+// user can react with several kinds, but with each kind only once.
+type Reaction struct {
+	TargetType string `json:"target_type"`
+	TargetID   int64  `json:"target_id"`
+	UserID     int64  `json:"user_id"`
+	Kind       string `json:"kind"`
+	CreatedAt  string `json:"created_at"`
+	User       User   `json:"user"`
+}
+
+// ReactionSummary is what a post carries about its reactions: how many of
+// each kind, and which kinds the viewer used.
+type ReactionSummary struct {
+	Counts map[string]int `json:"counts"`
+	Mine   []string       `json:"mine"`
+}
+
+func newReactionSummary() ReactionSummary {
+	return ReactionSummary{Counts: map[string]int{}, Mine: []string{}}
+}
+
+type ReactionStore struct {
+	db *sql.DB
+}
+
+// Add stores the reaction. Reacting twice with the same kind returns
+// ErrorConflict.
+func (s *ReactionStore) Add(ctx context.Context, reaction *Reaction) error {
+	t, ok := reactionTables[reaction.TargetType]
+	if !ok {
+		return ErrorNotFound
+	}
+	query := `INSERT INTO ` + t.table + ` (` + t.column + `,user_id,kind) VALUES ($1,$2,$3) RETURNING created_at`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	err := s.db.QueryRowContext(ctx, query, reaction.TargetID, reaction.UserID, reaction.Kind).Scan(&reaction.CreatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrorConflict
+		}
+		return err
+	}
+	return nil
+}
+
+// Remove deletes the user's reaction of the given kind.
+func (s *ReactionStore) Remove(ctx context.Context, targetType string, targetID, userID int64, kind string) error {
+	t, ok := reactionTables[targetType]
+	if !ok {
+		return ErrorNotFound
+	}
+	query := `DELETE FROM ` + t.table + ` WHERE ` + t.column + `=$1 AND user_id=$2 AND kind=$3`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, targetID, userID, kind)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrorNotFound
+	}
+	return nil
+}
+
+// List returns who reacted to the target, newest first.
+func (s *ReactionStore) List(ctx context.Context, targetType string, targetID int64, rq PaginatedReactionQuery) ([]Reaction, error) {
+	t, ok := reactionTables[targetType]
+	if !ok {
+		return nil, ErrorNotFound
+	}
+	query := `
+	SELECT r.user_id,r.kind,r.created_at,users.username FROM ` + t.table + ` r
+	JOIN users ON r.user_id=users.id
+	WHERE r.` + t.column + `=$1 AND ($2='' OR r.kind=$2)
+	ORDER BY r.created_at DESC,r.user_id
+	LIMIT $3 OFFSET $4
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, targetID, rq.Kind, rq.Limit, rq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	reactions := []Reaction{}
+	for rows.Next() {
+		r := Reaction{TargetType: targetType, TargetID: targetID}
+		if err := rows.Scan(&r.UserID, &r.Kind, &r.CreatedAt, &r.User.UserName); err != nil {
+			return nil, err
+		}
+		r.User.ID = r.UserID
+		reactions = append(reactions, r)
+	}
+	return reactions, rows.Err()
+}
+
+// Summaries aggregates the reactions of many targets in one query, so lists
+// of posts do not need a query per post. Every id gets a summary, empty if
+// nobody reacted.
+func (s *ReactionStore) Summaries(ctx context.Context, targetType string, ids []int64, viewerID int64) (map[int64]ReactionSummary, error) {
+	return reactionSummaries(ctx, s.db, targetType, ids, viewerID)
+}
+
+func reactionSummaries(ctx context.Context, db *sql.DB, targetType string, ids []int64, viewerID int64) (map[int64]ReactionSummary, error) {
+	t, ok := reactionTables[targetType]
+	if !ok {
+		return nil, ErrorNotFound
+	}
+	summaries := make(map[int64]ReactionSummary, len(ids))
+	for _, id := range ids {
+		summaries[id] = newReactionSummary()
+	}
+	if len(ids) == 0 {
+		return summaries, nil
+	}
+	query := `
+	SELECT ` + t.column + `,kind,COUNT(*),bool_or(user_id=$2) FROM ` + t.table + `
+	WHERE ` + t.column + `=ANY($1)
+	GROUP BY ` + t.column + `,kind
+	ORDER BY ` + t.column + `,kind
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids), viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			id    int64
+			kind  string
+			count int
+			mine  bool
+		)
+		if err := rows.Scan(&id, &kind, &count, &mine); err != nil {
+			return nil, err
+		}
+		summary := summaries[id]
+		summary.Counts[kind] = count
+		if mine {
+			summary.Mine = append(summary.Mine, kind)
+		}
+		summaries[id] = summary
+	}
+	return summaries, rows.Err()
+}
@@ -0,0 +1,176 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type RefreshToken struct {
+	Token     string     `json:"-"`
+	UserID    int64      `json:"user_id"`
+	FamilyID  string     `json:"family_id"`
+	Expiry    time.Time  `json:"expiry"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt string     `json:"created_at"`
+}
+
+type RefreshTokenStore struct {
+	db *sql.DB
+}
+
+func (s *RefreshTokenStore) Create(ctx context.Context, token *RefreshToken) error {
+	query := `
+	INSERT INTO refresh_tokens (token,user_id,family_id,expiry)
+	VALUES ($1,$2,$3,$4) RETURNING created_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	err := s.db.QueryRowContext(ctx, query, token.Token, token.UserID, token.FamilyID, token.Expiry).Scan(&token.CreatedAt)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Rotate revokes the refresh token identified by the hashed oldToken and stores
+// newToken in the same family. Presenting a token that was already rotated
+// revokes the whole family and returns ErrorTokenReused, with the user and
+// family of the compromised token filled in on newToken.
+func (s *RefreshTokenStore) Rotate(ctx context.Context, oldToken string, newToken *RefreshToken) error {
+	reused := false
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		current, err := s.getForUpdate(ctx, tx, oldToken)
+		if err != nil {
+			return err
+		}
+		newToken.UserID = current.UserID
+		newToken.FamilyID = current.FamilyID
+		if current.RevokedAt != nil {
+			reused = true
+			return s.revokeFamily(ctx, tx, current.FamilyID)
+		}
+		if current.Expiry.Before(time.Now()) {
+			return ErrorNotFound
+		}
+		if err := s.revoke(ctx, tx, oldToken); err != nil {
+			return err
+		}
+		return s.create(ctx, tx, newToken)
+	})
+	if err != nil {
+		return err
+	}
+	if reused {
+		return ErrorTokenReused
+	}
+	return nil
+}
+
+func (s *RefreshTokenStore) RevokeFamily(ctx context.Context, familyID string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.revokeFamily(ctx, tx, familyID)
+	})
+}
+
+// RevokeFamilyByToken ends the session the hashed token belongs to, as long as
+// it was issued to userID.
+func (s *RefreshTokenStore) RevokeFamilyByToken(ctx context.Context, userID int64, token string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		current, err := s.getForUpdate(ctx, tx, token)
+		if err != nil {
+			return err
+		}
+		if current.UserID != userID {
+			return ErrorNotFound
+		}
+		return s.revokeFamily(ctx, tx, current.FamilyID)
+	})
+}
+
+// RevokeByUser ends every session of the user and returns their ids.
+func (s *RefreshTokenStore) RevokeByUser(ctx context.Context, userID int64) ([]string, error) {
+	var sessionIDs []string
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var err error
+		sessionIDs, err = revokeUserRefreshTokens(ctx, tx, userID)
+		return err
+	})
+	return sessionIDs, err
+}
+
+func (s *RefreshTokenStore) getForUpdate(ctx context.Context, tx *sql.Tx, token string) (*RefreshToken, error) {
+	query := `
+	SELECT user_id,family_id,expiry,revoked_at,created_at FROM refresh_tokens
+	WHERE token=$1
+	FOR UPDATE
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	rt := &RefreshToken{Token: token}
+	err := tx.QueryRowContext(ctx, query, token).Scan(&rt.UserID, &rt.FamilyID, &rt.Expiry, &rt.RevokedAt, &rt.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+	return rt, nil
+}
+
+func (s *RefreshTokenStore) create(ctx context.Context, tx *sql.Tx, token *RefreshToken) error {
+	query := `
+	INSERT INTO refresh_tokens (token,user_id,family_id,expiry)
+	VALUES ($1,$2,$3,$4) RETURNING created_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	return tx.QueryRowContext(ctx, query, token.Token, token.UserID, token.FamilyID, token.Expiry).Scan(&token.CreatedAt)
+}
+
+func (s *RefreshTokenStore) revoke(ctx context.Context, tx *sql.Tx, token string) error {
+	query := `UPDATE refresh_tokens SET revoked_at=NOW() WHERE token=$1`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	_, err := tx.ExecContext(ctx, query, token)
+	return err
+}
+
+func (s *RefreshTokenStore) revokeFamily(ctx context.Context, tx *sql.Tx, familyID string) error {
+	query := `UPDATE refresh_tokens SET revoked_at=NOW() WHERE family_id=$1 AND revoked_at IS NULL`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	_, err := tx.ExecContext(ctx, query, familyID)
+	return err
+}
+
+// revokeUserRefreshTokens is shared with the user store so that credential
+// changes can end every session inside their own transaction. It returns
+// the ids of the sessions it ended, whose access tokens the caller still has
+// to put on the revocation list.
+func revokeUserRefreshTokens(ctx context.Context, tx *sql.Tx, userID int64) ([]string, error) {
+	query := `UPDATE refresh_tokens SET revoked_at=NOW() WHERE user_id=$1 AND revoked_at IS NULL`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+		return nil, err
+	}
+	query = `UPDATE sessions SET revoked_at=NOW() WHERE user_id=$1 AND revoked_at IS NULL RETURNING id`
+	rows, err := tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var sessionIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		sessionIDs = append(sessionIDs, id)
+	}
+	return sessionIDs, rows.Err()
+}
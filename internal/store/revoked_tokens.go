@@ -0,0 +1,49 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// RevokedTokenStore is the Postgres backed revocation list used when redis
+// is disabled. Entries stop matching once the revoked token would have
+// expired anyway and are cleaned up on the next revocation.
+type RevokedTokenStore struct {
+	db *sql.DB
+}
+
+func (s *RevokedTokenStore) Revoke(ctx context.Context, jti string, userID int64, expiry time.Time) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.deleteExpired(ctx, tx); err != nil {
+			return err
+		}
+		query := `
+		INSERT INTO revoked_tokens (jti,user_id,expiry) VALUES ($1,$2,$3)
+		ON CONFLICT (jti) DO NOTHING
+		`
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		_, err := tx.ExecContext(ctx, query, jti, userID, expiry)
+		return err
+	})
+}
+
+func (s *RevokedTokenStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti=$1 AND expiry>NOW())`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	var revoked bool
+	if err := s.db.QueryRowContext(ctx, query, jti).Scan(&revoked); err != nil {
+		return false, err
+	}
+	return revoked, nil
+}
+
+func (s *RevokedTokenStore) deleteExpired(ctx context.Context, tx *sql.Tx) error {
+	query := `DELETE FROM revoked_tokens WHERE expiry<=NOW()`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	_, err := tx.ExecContext(ctx, query)
+	return err
+}
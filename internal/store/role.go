@@ -5,27 +5,55 @@ import (
 	"database/sql"
 	"errors"
 	"log"
+	"sync"
+	"time"
 )
 
+// Permissions granted through roles. Owners can always update and delete
+// their own content, these cover everything else.
+const (
+	PermissionPostsUpdateAny = "posts.update.any"
+	PermissionPostsDeleteAny = "posts.delete.any"
+	PermissionUsersBan       = "users.ban"
+	PermissionUsersManage    = "users.manage"
+	PermissionAuditRead      = "audit.read"
+	PermissionPostsRevisions = "posts.revisions.read"
+	PermissionPostsRestore   = "posts.restore.any"
+	PermissionCommentsDelete = "comments.delete.any"
+)
+
+// permissionsCacheTTL bounds how long a change to role_permissions takes to
+// reach every API replica.
+const permissionsCacheTTL = time.Minute
+
 type Role struct {
 	Id          int64  `json:"id"`
 	Name        string `json:"name"`
 	Level       int64  `json:"level"`
 	Description string `json:"description"`
+	Requires2FA bool   `json:"requires_2fa"`
 }
 
 type RoleStore struct {
 	db *sql.DB
+
+	mu          sync.RWMutex
+	permissions map[int64]cachedPermissions
+}
+
+type cachedPermissions struct {
+	names   map[string]bool
+	expires time.Time
 }
 
 func (s *RoleStore) GetByName(ctx context.Context, name string) (*Role, error) {
 	query := `
-	SELECT id,name,level,description FROM roles where name=$1
+	SELECT id,name,level,description,requires_2fa FROM roles where name=$1
 	`
 	var role Role
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
-	err := s.db.QueryRowContext(ctx, query, role).Scan(&role.Id, &role.Name, &role.Level, &role.Description)
+	err := s.db.QueryRowContext(ctx, query, name).Scan(&role.Id, &role.Name, &role.Level, &role.Description, &role.Requires2FA)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -38,3 +66,74 @@ func (s *RoleStore) GetByName(ctx context.Context, name string) (*Role, error) {
 	return &role, err
 
 }
+
+// SetRequires2FA decides whether users of the role need two-factor
+// authentication before their role's permissions apply.
+func (s *RoleStore) SetRequires2FA(ctx context.Context, name string, required bool) error {
+	query := `UPDATE roles SET requires_2fa=$1 WHERE name=$2`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, required, name)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrorNotFound
+	}
+	return nil
+}
+
+// HasPermission reports whether the role grants permission. Role permissions
+// are cached in process since they are checked on every privileged request.
+func (s *RoleStore) HasPermission(ctx context.Context, roleID int64, permission string) (bool, error) {
+	s.mu.RLock()
+	cached, ok := s.permissions[roleID]
+	s.mu.RUnlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.names[permission], nil
+	}
+	names, err := s.GetPermissions(ctx, roleID)
+	if err != nil {
+		return false, err
+	}
+	cached = cachedPermissions{names: make(map[string]bool, len(names)), expires: time.Now().Add(permissionsCacheTTL)}
+	for _, name := range names {
+		cached.names[name] = true
+	}
+	s.mu.Lock()
+	if s.permissions == nil {
+		s.permissions = make(map[int64]cachedPermissions)
+	}
+	s.permissions[roleID] = cached
+	s.mu.Unlock()
+	return cached.names[permission], nil
+}
+
+func (s *RoleStore) GetPermissions(ctx context.Context, roleID int64) ([]string, error) {
+	query := `
+	SELECT p.name FROM permissions p
+	JOIN role_permissions rp ON rp.permission_id=p.id
+	WHERE rp.role_id=$1
+	ORDER BY p.name
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, roleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	permissions := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, name)
+	}
+	return permissions, rows.Err()
+}
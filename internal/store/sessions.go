@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Session is a sign-in on one device. Its id is the family id of the
+// refresh tokens issued for it and the sid claim of its access tokens.
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     int64      `json:"user_id"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  string     `json:"created_at"`
+	Current    bool       `json:"current"`
+}
+
+type SessionStore struct {
+	db *sql.DB
+}
+
+func (s *SessionStore) Create(ctx context.Context, session *Session) error {
+	query := `
+	INSERT INTO sessions (id,user_id,user_agent,ip)
+	VALUES ($1,$2,$3,$4) RETURNING last_seen_at,created_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	return s.db.QueryRowContext(ctx, query, session.ID, session.UserID, session.UserAgent, session.IP).Scan(&session.LastSeenAt, &session.CreatedAt)
+}
+
+// GetByUser lists the sessions that can still be refreshed.
+func (s *SessionStore) GetByUser(ctx context.Context, userID int64) ([]Session, error) {
+	query := `
+	SELECT s.id,s.user_id,s.user_agent,s.ip,s.last_seen_at,s.created_at FROM sessions s
+	WHERE s.user_id=$1 AND s.revoked_at IS NULL AND
+	EXISTS(SELECT 1 FROM refresh_tokens rt WHERE rt.family_id=s.id AND rt.revoked_at IS NULL AND rt.expiry>NOW())
+	ORDER BY s.last_seen_at DESC
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sessions := []Session{}
+	for rows.Next() {
+		var session Session
+		if err := rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.LastSeenAt, &session.CreatedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// Revoke ends a session of userID along with its refresh tokens.
+func (s *SessionStore) Revoke(ctx context.Context, userID int64, id string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `UPDATE sessions SET revoked_at=NOW() WHERE id=$1 AND user_id=$2 AND revoked_at IS NULL`
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		res, err := tx.ExecContext(ctx, query, id, userID)
+		if err != nil {
+			return err
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrorNotFound
+		}
+		query = `UPDATE refresh_tokens SET revoked_at=NOW() WHERE family_id=$1 AND revoked_at IS NULL`
+		_, err = tx.ExecContext(ctx, query, id)
+		return err
+	})
+}
+
+// TouchMany writes a batch of last seen times collected in memory.
+func (s *SessionStore) TouchMany(ctx context.Context, lastSeen map[string]time.Time) error {
+	if len(lastSeen) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(lastSeen))
+	seen := make([]time.Time, 0, len(lastSeen))
+	for id, at := range lastSeen {
+		ids = append(ids, id)
+		seen = append(seen, at)
+	}
+	query := `
+	UPDATE sessions SET last_seen_at=v.seen
+	FROM unnest($1::uuid[],$2::timestamptz[]) AS v(id,seen)
+	WHERE sessions.id=v.id AND sessions.last_seen_at<v.seen
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, query, pq.Array(ids), pq.Array(seen))
+	return err
+}
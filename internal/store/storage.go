@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"errors"
 	"time"
+
+	"github.com/vadiraj/gopher/internal/hashing"
 )
 
 var (
@@ -13,28 +15,60 @@ var (
 	QueryTimeoutDuration   = time.Second * 5
 	ErrorDuplicateEmail    = errors.New("email already exists")
 	ErrorDuplicateUsername = errors.New("username already exists")
+	ErrorTokenReused       = errors.New("refresh token has already been used")
 )
 
 type Storage struct {
 	Posts interface {
 		Create(context.Context, *Post) error
-		GetById(context.Context, int64) (*Post, error)
+		GetById(ctx context.Context, postID, viewerID int64) (*Post, error)
 		Delete(context.Context, int64) error
 		Update(context.Context, *Post) error
 		GetUserFeed(context.Context, int64, PaginatedFeedQuery) ([]PostWithMetadata, error)
+		GetRevisions(ctx context.Context, postID int64) ([]PostRevision, error)
+		GetRevision(ctx context.Context, postID int64, version int) (*PostRevision, error)
+		RestoreRevision(ctx context.Context, post *Post, version int) error
+		GetDeletedById(ctx context.Context, postID int64, retention time.Duration) (*Post, error)
+		GetTrash(ctx context.Context, tq PaginatedTrashQuery, retention time.Duration) ([]Post, error)
+		Restore(ctx context.Context, postID int64, retention time.Duration) error
+		Purge(ctx context.Context, retention time.Duration) (int64, error)
+		PublishDue(ctx context.Context, limit int) ([]int64, error)
 	}
 	Users interface {
 		Create(context.Context, *sql.Tx, *User) error
 		GetById(context.Context, int64) (*User, error)
 		CreateAndInvite(ctx context.Context, user *User, token string, invitationExp time.Duration) error
+		CreateWithInviteCode(ctx context.Context, user *User, inviteCode, token string, invitationExp time.Duration) error
 		createUserInvitation(ctx context.Context, tx *sql.Tx, token string, invitationExp time.Duration, userId int64) error
-		Activate(context.Context, string) error
+		Activate(context.Context, string) (*User, error)
 		Delete(ctx context.Context, userId int64) error
 		GetByEmail(ctx context.Context, email string) (*User, error)
+		CreatePasswordReset(ctx context.Context, userId int64, token string, exp time.Duration) error
+		ResetPassword(ctx context.Context, token, newPassword string) (*User, []string, error)
+		UpdatePasswordHash(ctx context.Context, user *User) error
+		GetByPasswordReset(ctx context.Context, token string) (*User, error)
+		ChangePassword(ctx context.Context, user *User) ([]string, error)
+		CreateMagicLink(ctx context.Context, userId int64, token string, exp time.Duration) error
+		ConsumeMagicLink(ctx context.Context, token string) (*User, error)
+		ReissueInvitation(ctx context.Context, email, token string, invitationExp time.Duration) (*User, error)
+		DeleteExpiredInvitations(ctx context.Context, grace time.Duration) (int64, error)
+		CreateEmailChange(ctx context.Context, userId int64, newEmail, token, cancelToken string, exp time.Duration) error
+		ConfirmEmailChange(ctx context.Context, token string) (*User, error)
+		CancelEmailChange(ctx context.Context, cancelToken string) error
+		GetByIdAny(ctx context.Context, id int64) (*User, error)
+		List(ctx context.Context, uq PaginatedUserQuery) ([]User, error)
+		SetRole(ctx context.Context, userId, roleId int64) error
+		SetActive(ctx context.Context, userId int64, active bool) ([]string, error)
 	}
 	Comments interface {
-		GetByPostID(context.Context, int64) ([]Comment, error)
+		GetByPostID(ctx context.Context, postID int64, cq PaginatedCommentQuery) ([]Comment, error)
 		Create(context.Context, *Comment) error
+		GetById(ctx context.Context, commentID int64) (*Comment, error)
+		Update(ctx context.Context, comment *Comment) error
+		Delete(ctx context.Context, commentID int64) error
+		GetDeletedById(ctx context.Context, commentID int64, retention time.Duration) (*Comment, error)
+		Restore(ctx context.Context, commentID int64, retention time.Duration) error
+		Purge(ctx context.Context, retention time.Duration) (int64, error)
 	}
 	Followers interface {
 		Follow(context.Context, int64, int64) error
@@ -42,16 +76,92 @@ type Storage struct {
 	}
 	Roles interface {
 		GetByName(context.Context, string) (*Role, error)
+		SetRequires2FA(ctx context.Context, name string, required bool) error
+		GetPermissions(ctx context.Context, roleID int64) ([]string, error)
+		HasPermission(ctx context.Context, roleID int64, permission string) (bool, error)
+	}
+	RefreshTokens interface {
+		Create(context.Context, *RefreshToken) error
+		Rotate(ctx context.Context, oldToken string, newToken *RefreshToken) error
+		RevokeFamily(ctx context.Context, familyID string) error
+		RevokeFamilyByToken(ctx context.Context, userID int64, token string) error
+		RevokeByUser(ctx context.Context, userID int64) ([]string, error)
+	}
+	TwoFactor interface {
+		Enroll(ctx context.Context, userID int64, secret string) error
+		Get(ctx context.Context, userID int64) (*TOTP, error)
+		Confirm(ctx context.Context, userID, step int64, recoveryCodes []string) error
+		MarkUsed(ctx context.Context, userID, step int64) error
+		UseRecoveryCode(ctx context.Context, userID int64, code string) error
+		Disable(ctx context.Context, userID int64) error
+		CreateChallenge(ctx context.Context, userID int64, token string, exp time.Duration) error
+		GetChallenge(ctx context.Context, token string) (int64, error)
+		RecordChallengeFailure(ctx context.Context, token string) error
+		DeleteChallenge(ctx context.Context, token string) error
+	}
+	AccessTokens interface {
+		Create(context.Context, *AccessToken) error
+		GetByUser(ctx context.Context, userID int64) ([]AccessToken, error)
+		GetByToken(ctx context.Context, token string) (*AccessToken, error)
+		Touch(ctx context.Context, id int64) error
+		Revoke(ctx context.Context, userID, id int64) error
+	}
+	RevokedTokens interface {
+		Revoke(ctx context.Context, jti string, userID int64, expiry time.Time) error
+		IsRevoked(ctx context.Context, jti string) (bool, error)
+	}
+	Sessions interface {
+		Create(context.Context, *Session) error
+		GetByUser(ctx context.Context, userID int64) ([]Session, error)
+		Revoke(ctx context.Context, userID int64, id string) error
+		TouchMany(ctx context.Context, lastSeen map[string]time.Time) error
+	}
+	AuditLogs interface {
+		Create(context.Context, *AuditLog) error
+		List(ctx context.Context, aq AuditLogQuery) ([]AuditLog, error)
+	}
+	InviteCodes interface {
+		CreateBatch(ctx context.Context, codes []*InviteCode) error
+		CreateWithinQuota(ctx context.Context, code *InviteCode, quota int) error
+		GetByCreator(ctx context.Context, userID int64) ([]InviteCode, error)
+	}
+	Waitlist interface {
+		Add(ctx context.Context, email string) error
+		List(ctx context.Context, wq PaginatedWaitlistQuery) ([]WaitlistEntry, error)
+		Invite(ctx context.Context, codes []*InviteCode) ([]WaitlistEntry, error)
+	}
+	Reactions interface {
+		Add(ctx context.Context, reaction *Reaction) error
+		Remove(ctx context.Context, targetType string, targetID, userID int64, kind string) error
+		List(ctx context.Context, targetType string, targetID int64, rq PaginatedReactionQuery) ([]Reaction, error)
+		Summaries(ctx context.Context, targetType string, ids []int64, viewerID int64) (map[int64]ReactionSummary, error)
+	}
+	Identities interface {
+		GetUserID(ctx context.Context, provider, subject string) (int64, error)
+		Link(ctx context.Context, provider, subject string, userID int64, email string) error
+		CreateUser(ctx context.Context, user *User, provider, subject string) error
 	}
 }
 
-func NewStorage(db *sql.DB) Storage {
+// NewStorage wires the stores to db. hasher is used for passwords the store
+// sets itself, such as on a password reset.
+func NewStorage(db *sql.DB, hasher hashing.Hasher) Storage {
 	return Storage{
-		Posts:     &PostStore{db: db},
-		Users:     &UserStore{db: db},
-		Comments:  &CommentStore{db: db},
-		Followers: &FollowerStore{db: db},
-		Roles:     &RoleStore{db: db},
+		Posts:         &PostStore{db: db},
+		Users:         &UserStore{db: db, hasher: hasher},
+		Comments:      &CommentStore{db: db},
+		Followers:     &FollowerStore{db: db},
+		Roles:         &RoleStore{db: db},
+		RefreshTokens: &RefreshTokenStore{db: db},
+		RevokedTokens: &RevokedTokenStore{db: db},
+		TwoFactor:     &TwoFactorStore{db: db},
+		AccessTokens:  &AccessTokenStore{db: db},
+		Identities:    &IdentityStore{db: db},
+		AuditLogs:     &AuditLogStore{db: db},
+		Sessions:      &SessionStore{db: db},
+		InviteCodes:   &InviteCodeStore{db: db},
+		Waitlist:      &WaitlistStore{db: db},
+		Reactions:     &ReactionStore{db: db},
 	}
 }
 
@@ -0,0 +1,194 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// maxChallengeAttempts bounds how many codes can be tried against a single
+// login challenge before the password has to be entered again.
+const maxChallengeAttempts = 5
+
+type TOTP struct {
+	UserID       int64      `json:"user_id"`
+	Secret       string     `json:"-"`
+	LastUsedStep int64      `json:"-"`
+	ConfirmedAt  *time.Time `json:"confirmed_at"`
+	CreatedAt    string     `json:"created_at"`
+}
+
+type TwoFactorStore struct {
+	db *sql.DB
+}
+
+// Enroll stores a fresh, unconfirmed secret for the user. It replaces an
+// earlier unconfirmed enrollment but never a confirmed one.
+func (s *TwoFactorStore) Enroll(ctx context.Context, userID int64, secret string) error {
+	query := `
+	INSERT INTO user_totp (user_id,secret) VALUES ($1,$2)
+	ON CONFLICT (user_id) DO UPDATE SET secret=EXCLUDED.secret,last_used_step=0,created_at=NOW()
+	WHERE user_totp.confirmed_at IS NULL
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrorConflict
+	}
+	return nil
+}
+
+func (s *TwoFactorStore) Get(ctx context.Context, userID int64) (*TOTP, error) {
+	query := `SELECT user_id,secret,last_used_step,confirmed_at,created_at FROM user_totp WHERE user_id=$1`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	var totp TOTP
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&totp.UserID, &totp.Secret, &totp.LastUsedStep, &totp.ConfirmedAt, &totp.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &totp, nil
+}
+
+// Confirm activates the enrollment with the step of the first valid code and
+// replaces the user's recovery codes with the given hashes.
+func (s *TwoFactorStore) Confirm(ctx context.Context, userID, step int64, recoveryCodes []string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+		UPDATE user_totp SET confirmed_at=NOW(),last_used_step=$2
+		WHERE user_id=$1 AND confirmed_at IS NULL
+		`
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		res, err := tx.ExecContext(ctx, query, userID, step)
+		if err != nil {
+			return err
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrorConflict
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id=$1`, userID); err != nil {
+			return err
+		}
+		for _, code := range recoveryCodes {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO user_recovery_codes (code,user_id) VALUES ($1,$2)`, code, userID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MarkUsed records the step of an accepted code. A concurrent request that
+// already used the same or a later step makes it return ErrorConflict.
+func (s *TwoFactorStore) MarkUsed(ctx context.Context, userID, step int64) error {
+	query := `UPDATE user_totp SET last_used_step=$2 WHERE user_id=$1 AND last_used_step<$2`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrorConflict
+	}
+	return nil
+}
+
+func (s *TwoFactorStore) UseRecoveryCode(ctx context.Context, userID int64, code string) error {
+	query := `UPDATE user_recovery_codes SET used_at=NOW() WHERE code=$1 AND user_id=$2 AND used_at IS NULL`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, code, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrorNotFound
+	}
+	return nil
+}
+
+func (s *TwoFactorStore) Disable(ctx context.Context, userID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id=$1`, userID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM user_totp WHERE user_id=$1`, userID)
+		return err
+	})
+}
+
+func (s *TwoFactorStore) CreateChallenge(ctx context.Context, userID int64, token string, exp time.Duration) error {
+	query := `INSERT INTO two_factor_challenges (token,user_id,expiry) VALUES ($1,$2,$3)`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, query, token, userID, time.Now().Add(exp))
+	return err
+}
+
+// GetChallenge returns the user a pending login challenge belongs to.
+func (s *TwoFactorStore) GetChallenge(ctx context.Context, token string) (int64, error) {
+	query := `
+	SELECT user_id FROM two_factor_challenges
+	WHERE token=$1 AND expiry>NOW() AND attempts<$2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	var userID int64
+	err := s.db.QueryRowContext(ctx, query, token, maxChallengeAttempts).Scan(&userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrorNotFound
+		default:
+			return 0, err
+		}
+	}
+	return userID, nil
+}
+
+func (s *TwoFactorStore) RecordChallengeFailure(ctx context.Context, token string) error {
+	query := `UPDATE two_factor_challenges SET attempts=attempts+1 WHERE token=$1`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, query, token)
+	return err
+}
+
+// DeleteChallenge consumes the challenge and clears any that have expired.
+func (s *TwoFactorStore) DeleteChallenge(ctx context.Context, token string) error {
+	query := `DELETE FROM two_factor_challenges WHERE token=$1 OR expiry<=NOW()`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, query, token)
+	return err
+}
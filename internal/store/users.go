@@ -9,7 +9,7 @@ import (
 	"log"
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
+	"github.com/vadiraj/gopher/internal/hashing"
 )
 
 type User struct {
@@ -21,6 +21,10 @@ type User struct {
 	IsActive  bool     `json:"is_active"`
 	RoleID    int64    `json:"role_id"`
 	Role      Role     `json:"role"`
+	//TwoFactorEnabled is set once a TOTP enrollment has been confirmed
+	TwoFactorEnabled bool `json:"two_factor_enabled"`
+	//DeactivatedAt is set while an admin has the user deactivated
+	DeactivatedAt *time.Time `json:"deactivated_at,omitempty"`
 }
 
 type password struct {
@@ -28,22 +32,31 @@ type password struct {
 	hash []byte
 }
 
-func (p *password) Set(text string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(text), bcrypt.DefaultCost)
+func (p *password) Set(hasher hashing.Hasher, text string) error {
+	hash, err := hasher.Hash(text)
 	if err != nil {
 		return err
 	}
 	p.text = &text
-	p.hash = hash
+	p.hash = []byte(hash)
 	return nil
 }
 
-func (p *password) Compare(text string) error {
-	return bcrypt.CompareHashAndPassword(p.hash, []byte(text))
+func (p *password) Compare(hasher hashing.Hasher, text string) error {
+	_, err := p.Verify(hasher, text)
+	return err
+}
+
+// Verify checks text against the stored hash. needsRehash is set when the
+// hash should be replaced, see UpdatePasswordHash.
+func (p *password) Verify(hasher hashing.Hasher, text string) (needsRehash bool, err error) {
+	return hasher.Verify(text, string(p.hash))
 }
 
 type UserStore struct {
 	db *sql.DB
+	//hasher hashes the passwords set by ResetPassword
+	hasher hashing.Hasher
 }
 
 func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
@@ -73,16 +86,18 @@ func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 
 func (s *UserStore) GetById(ctx context.Context, id int64) (*User, error) {
 	query := `
-	SELECT users.id,users.username,users.password,users.email,users.created_at,roles.*
+	SELECT users.id,users.username,users.password,users.email,users.created_at,
+	roles.id,roles.name,roles.level,roles.description,roles.requires_2fa,
+	EXISTS(SELECT 1 FROM user_totp t WHERE t.user_id=users.id AND t.confirmed_at IS NOT NULL)
 	FROM users 
 	JOIN roles ON (users.role_id=roles.id)
 	WHERE
-	users.id=$1 AND users.is_active=true
+	users.id=$1 AND users.is_active=true AND users.deactivated_at IS NULL
 	`
 	var user User
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
-	err := s.db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.UserName, &user.Password.hash, &user.Email, &user.CreatedAt, &user.Role.Id, &user.Role.Name, &user.Role.Level, &user.Role.Description)
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.UserName, &user.Password.hash, &user.Email, &user.CreatedAt, &user.Role.Id, &user.Role.Name, &user.Role.Level, &user.Role.Description, &user.Role.Requires2FA, &user.TwoFactorEnabled)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -109,18 +124,35 @@ func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token strin
 	})
 }
 
-func (s *UserStore) Activate(ctx context.Context, token string) error {
+// CreateWithInviteCode is CreateAndInvite for invite only registration. The
+// code is used up in the same transaction, ErrorInviteCodeInvalid means it
+// could not be.
+func (s *UserStore) CreateWithInviteCode(ctx context.Context, user *User, inviteCode, token string, invitationExp time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := redeemInviteCode(ctx, tx, inviteCode); err != nil {
+			return err
+		}
+		if err := s.Create(ctx, tx, user); err != nil {
+			return err
+		}
+		return s.createUserInvitation(ctx, tx, token, invitationExp, user.ID)
+	})
+}
+
+func (s *UserStore) Activate(ctx context.Context, token string) (*User, error) {
 	//1. find the user that this token belongs to
 	//2. update the user
 	//3. clean up the invitation table
-	return withTx(s.db, ctx, func(tx *sql.Tx) error {
-		user, err := s.getUserFromInvitation(ctx, tx, token)
+	var user *User
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var err error
+		user, err = s.getUserFromInvitation(ctx, tx, token)
 		if err != nil {
 			return err
 		}
 		//update the user
 		user.IsActive = true
-		if err := s.update(ctx, tx, user); err != nil {
+		if err := s.activate(ctx, tx, user.ID); err != nil {
 			return err
 		}
 		//clean up invitations
@@ -129,6 +161,10 @@ func (s *UserStore) Activate(ctx context.Context, token string) error {
 		}
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
 }
 
 func (s *UserStore) Delete(ctx context.Context, userId int64) error {
@@ -145,13 +181,14 @@ func (s *UserStore) Delete(ctx context.Context, userId int64) error {
 
 func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
-	SELECT id,username,password,email,created_at
-	FROM users WHERE email=$1 AND is_active=true
+	SELECT id,username,password,email,created_at,
+	EXISTS(SELECT 1 FROM user_totp t WHERE t.user_id=users.id AND t.confirmed_at IS NOT NULL)
+	FROM users WHERE email=$1 AND is_active=true AND deactivated_at IS NULL
 	`
 	var user User
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
-	err := s.db.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.UserName, &user.Password.hash, &user.Email, &user.CreatedAt)
+	err := s.db.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.UserName, &user.Password.hash, &user.Email, &user.CreatedAt, &user.TwoFactorEnabled)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -164,12 +201,296 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error)
 	return &user, err
 }
 
+// CreatePasswordReset stores a hashed reset token for the user, replacing any
+// reset that is still outstanding.
+func (s *UserStore) CreatePasswordReset(ctx context.Context, userId int64, token string, exp time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.deletePasswordResets(ctx, tx, userId); err != nil {
+			return err
+		}
+		query := `INSERT INTO password_resets (token,user_id,expiry) VALUES ($1,$2,$3)`
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		_, err := tx.ExecContext(ctx, query, token, userId, time.Now().Add(exp))
+		return err
+	})
+}
+
+// ResetPassword consumes the reset token, sets the new password and revokes
+// every refresh token the user holds. It returns the ids of the sessions it
+// ended.
+func (s *UserStore) ResetPassword(ctx context.Context, token, newPassword string) (*User, []string, error) {
+	var user *User
+	var sessionIDs []string
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var err error
+		user, err = s.getUserFromPasswordReset(ctx, tx, token)
+		if err != nil {
+			return err
+		}
+		if err := user.Password.Set(s.hasher, newPassword); err != nil {
+			return err
+		}
+		if err := s.updatePassword(ctx, tx, user); err != nil {
+			return err
+		}
+		if err := s.deletePasswordResets(ctx, tx, user.ID); err != nil {
+			return err
+		}
+		sessionIDs, err = revokeUserRefreshTokens(ctx, tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, sessionIDs, nil
+}
+
+// GetByPasswordReset returns the user a valid reset token belongs to without
+// consuming it, so the new password can be checked first.
+func (s *UserStore) GetByPasswordReset(ctx context.Context, token string) (*User, error) {
+	var user *User
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var err error
+		user, err = s.getUserFromPasswordReset(ctx, tx, token)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ChangePassword stores the user's new password and, like a reset, revokes
+// every refresh token the user holds. It returns the ids of the sessions it
+// ended.
+func (s *UserStore) ChangePassword(ctx context.Context, user *User) ([]string, error) {
+	var sessionIDs []string
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.updatePassword(ctx, tx, user); err != nil {
+			return err
+		}
+		var err error
+		sessionIDs, err = revokeUserRefreshTokens(ctx, tx, user.ID)
+		return err
+	})
+	return sessionIDs, err
+}
+
+// CreateMagicLink stores a hashed sign in token for the user, replacing any
+// link that was not used yet.
+func (s *UserStore) CreateMagicLink(ctx context.Context, userId int64, token string, exp time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		if _, err := tx.ExecContext(ctx, `DELETE FROM magic_links WHERE user_id=$1`, userId); err != nil {
+			return err
+		}
+		query := `INSERT INTO magic_links (token,user_id,expiry) VALUES ($1,$2,$3)`
+		_, err := tx.ExecContext(ctx, query, token, userId, time.Now().Add(exp))
+		return err
+	})
+}
+
+// ConsumeMagicLink deletes the link so it cannot be used twice and returns
+// the active user it was issued to.
+func (s *UserStore) ConsumeMagicLink(ctx context.Context, token string) (*User, error) {
+	query := `
+	DELETE FROM magic_links ml USING users u
+	WHERE ml.token=$1 AND ml.user_id=u.id AND ml.expiry>$2 AND u.is_active=true AND u.deactivated_at IS NULL
+	RETURNING u.id
+	`
+	hash := sha256.Sum256([]byte(token))
+	hashToken := hex.EncodeToString(hash[:])
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	var userId int64
+	err := s.db.QueryRowContext(ctx, query, hashToken, time.Now()).Scan(&userId)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+	return s.GetById(ctx, userId)
+}
+
+// ReissueInvitation replaces the invitations of a user that has never been
+// activated, so only the newest token works. Deactivated users are not
+// found here, only an admin can bring them back.
+func (s *UserStore) ReissueInvitation(ctx context.Context, email, token string, invitationExp time.Duration) (*User, error) {
+	var user *User
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var err error
+		user, err = s.getInactiveByEmail(ctx, tx, email)
+		if err != nil {
+			return err
+		}
+		if err := s.deleteUserInvitation(ctx, tx, user.ID); err != nil {
+			return err
+		}
+		return s.createUserInvitation(ctx, tx, token, invitationExp, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// DeleteExpiredInvitations removes users that never activated their account
+// and whose invitations all expired more than grace ago, then the expired
+// invitations themselves. It returns the number of users removed.
+// Deactivated users are left alone.
+func (s *UserStore) DeleteExpiredInvitations(ctx context.Context, grace time.Duration) (int64, error) {
+	var deleted int64
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		cutoff := time.Now().Add(-grace)
+		query := `
+		DELETE FROM users u WHERE u.activated_at IS NULL AND u.deactivated_at IS NULL
+		AND EXISTS(SELECT 1 FROM user_invitations ui WHERE ui.user_id=u.id AND ui.expiry<$1)
+		AND NOT EXISTS(SELECT 1 FROM user_invitations ui WHERE ui.user_id=u.id AND ui.expiry>=$1)
+		`
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		res, err := tx.ExecContext(ctx, query, cutoff)
+		if err != nil {
+			return err
+		}
+		if deleted, err = res.RowsAffected(); err != nil {
+			return err
+		}
+		query = `DELETE FROM user_invitations WHERE expiry<$1`
+		_, err = tx.ExecContext(ctx, query, cutoff)
+		return err
+	})
+	return deleted, err
+}
+
+func (s *UserStore) getInactiveByEmail(ctx context.Context, tx *sql.Tx, email string) (*User, error) {
+	query := `
+	SELECT id,username,email,created_at,is_active FROM users
+	WHERE email=$1 AND activated_at IS NULL AND deactivated_at IS NULL
+	FOR UPDATE
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	user := &User{}
+	err := tx.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.UserName, &user.Email, &user.CreatedAt, &user.IsActive)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// CreateEmailChange records a pending change to newEmail, replacing any
+// change the user already had pending. The current email keeps working
+// until the change is confirmed.
+func (s *UserStore) CreateEmailChange(ctx context.Context, userId int64, newEmail, token, cancelToken string, exp time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		var taken bool
+		query := `SELECT EXISTS(SELECT 1 FROM users WHERE email=$1)`
+		if err := tx.QueryRowContext(ctx, query, newEmail).Scan(&taken); err != nil {
+			return err
+		}
+		if taken {
+			return ErrorDuplicateEmail
+		}
+		if err := s.deleteEmailChanges(ctx, tx, userId); err != nil {
+			return err
+		}
+		query = `INSERT INTO email_changes (token,cancel_token,user_id,new_email,expiry) VALUES ($1,$2,$3,$4,$5)`
+		_, err := tx.ExecContext(ctx, query, token, cancelToken, userId, newEmail, time.Now().Add(exp))
+		return err
+	})
+}
+
+// ConfirmEmailChange switches the user to the pending email. The unique
+// constraint on users.email is the final word if the address was taken
+// after the change was requested.
+func (s *UserStore) ConfirmEmailChange(ctx context.Context, token string) (*User, error) {
+	var user *User
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+		SELECT u.id,u.username,u.email,u.created_at,u.is_active,ec.new_email FROM
+		users u
+		JOIN email_changes ec ON u.id=ec.user_id
+		WHERE ec.token=$1 AND ec.expiry>$2 AND u.is_active=true AND u.deactivated_at IS NULL
+		FOR UPDATE OF ec
+		`
+		hash := sha256.Sum256([]byte(token))
+		hashToken := hex.EncodeToString(hash[:])
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		user = &User{}
+		var newEmail string
+		err := tx.QueryRowContext(ctx, query, hashToken, time.Now()).Scan(&user.ID, &user.UserName, &user.Email, &user.CreatedAt, &user.IsActive, &newEmail)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrorNotFound
+			default:
+				return err
+			}
+		}
+		user.Email = newEmail
+		if err := s.update(ctx, tx, user); err != nil {
+			if err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"` {
+				return ErrorDuplicateEmail
+			}
+			return err
+		}
+		return s.deleteEmailChanges(ctx, tx, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// CancelEmailChange drops the pending change the cancel token belongs to.
+func (s *UserStore) CancelEmailChange(ctx context.Context, cancelToken string) error {
+	query := `DELETE FROM email_changes WHERE cancel_token=$1`
+	hash := sha256.Sum256([]byte(cancelToken))
+	hashToken := hex.EncodeToString(hash[:])
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, hashToken)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrorNotFound
+	}
+	return nil
+}
+
+func (s *UserStore) deleteEmailChanges(ctx context.Context, tx *sql.Tx, userId int64) error {
+	query := `DELETE FROM email_changes WHERE user_id=$1`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	_, err := tx.ExecContext(ctx, query, userId)
+	return err
+}
+
 func (s *UserStore) getUserFromInvitation(ctx context.Context, tx *sql.Tx, token string) (*User, error) {
 	query := `
 	SELECT u.id, u.username,u.email,u.created_at,u.is_active FROM 
 	users u 
 	JOIN user_invitations ui ON u.id=ui.user_id
-	WHERE ui.token=$1 AND ui.expiry>$2
+	WHERE ui.token=$1 AND ui.expiry>$2 AND u.deactivated_at IS NULL
 	`
 	hash := sha256.Sum256([]byte(token))
 	hashToken := hex.EncodeToString(hash[:])
@@ -199,6 +520,16 @@ func (s *UserStore) createUserInvitation(ctx context.Context, tx *sql.Tx, token
 	return nil
 }
 
+// activate marks the user as activated, which also keeps ReissueInvitation
+// and DeleteExpiredInvitations away from it for good.
+func (s *UserStore) activate(ctx context.Context, tx *sql.Tx, userId int64) error {
+	query := `UPDATE users SET is_active=true,activated_at=NOW() WHERE id=$1`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	_, err := tx.ExecContext(ctx, query, userId)
+	return err
+}
+
 func (s *UserStore) update(ctx context.Context, tx *sql.Tx, user *User) error {
 	query := `UPDATE users SET username=$1,email=$2,is_active=$3 WHERE id=$4`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -210,6 +541,55 @@ func (s *UserStore) update(ctx context.Context, tx *sql.Tx, user *User) error {
 	return nil
 }
 
+func (s *UserStore) getUserFromPasswordReset(ctx context.Context, tx *sql.Tx, token string) (*User, error) {
+	query := `
+	SELECT u.id,u.username,u.email,u.created_at,u.is_active FROM
+	users u
+	JOIN password_resets pr ON u.id=pr.user_id
+	WHERE pr.token=$1 AND pr.expiry>$2 AND u.is_active=true AND u.deactivated_at IS NULL
+	FOR UPDATE OF pr
+	`
+	hash := sha256.Sum256([]byte(token))
+	hashToken := hex.EncodeToString(hash[:])
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	user := &User{}
+	err := tx.QueryRowContext(ctx, query, hashToken, time.Now()).Scan(&user.ID, &user.UserName, &user.Email, &user.CreatedAt, &user.IsActive)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// UpdatePasswordHash stores a rehashed password. Unlike a password reset it
+// leaves the user's sessions alone.
+func (s *UserStore) UpdatePasswordHash(ctx context.Context, user *User) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.updatePassword(ctx, tx, user)
+	})
+}
+
+func (s *UserStore) updatePassword(ctx context.Context, tx *sql.Tx, user *User) error {
+	query := `UPDATE users SET password=$1 WHERE id=$2`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	_, err := tx.ExecContext(ctx, query, user.Password.hash, user.ID)
+	return err
+}
+
+func (s *UserStore) deletePasswordResets(ctx context.Context, tx *sql.Tx, userId int64) error {
+	query := `DELETE FROM password_resets WHERE user_id=$1`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	_, err := tx.ExecContext(ctx, query, userId)
+	return err
+}
+
 func (s *UserStore) deleteUserInvitation(ctx context.Context, tx *sql.Tx, userId int64) error {
 	query := `DELETE FROM user_invitations WHERE user_id=$1`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -231,3 +611,120 @@ func (s *UserStore) delete(ctx context.Context, tx *sql.Tx, userId int64) error
 	}
 	return nil
 }
+
+// GetByIdAny is GetById for admin tooling, it also finds deactivated users.
+func (s *UserStore) GetByIdAny(ctx context.Context, id int64) (*User, error) {
+	query := `
+	SELECT users.id,users.username,users.email,users.created_at,users.is_active,users.deactivated_at,
+	roles.id,roles.name,roles.level,roles.description,roles.requires_2fa
+	FROM users
+	JOIN roles ON (users.role_id=roles.id)
+	WHERE users.id=$1
+	`
+	var user User
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.UserName, &user.Email, &user.CreatedAt, &user.IsActive, &user.DeactivatedAt, &user.Role.Id, &user.Role.Name, &user.Role.Level, &user.Role.Description, &user.Role.Requires2FA)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+	user.RoleID = user.Role.Id
+	return &user, nil
+}
+
+func (s *UserStore) List(ctx context.Context, uq PaginatedUserQuery) ([]User, error) {
+	query := `
+	SELECT users.id,users.username,users.email,users.created_at,users.is_active,users.deactivated_at,
+	roles.id,roles.name,roles.level,roles.description,roles.requires_2fa
+	FROM users
+	JOIN roles ON (users.role_id=roles.id)
+	WHERE
+	($3='' OR roles.name=$3) AND
+	($4::boolean IS NULL OR users.is_active=$4) AND
+	($5::timestamptz IS NULL OR users.created_at>=$5) AND
+	($6::timestamptz IS NULL OR users.created_at<=$6)
+	ORDER BY users.id
+	LIMIT $1 OFFSET $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, uq.Limit, uq.Offset, uq.Role, uq.IsActive, nullString(uq.CreatedAfter), nullString(uq.CreatedBefore))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := []User{}
+	for rows.Next() {
+		var user User
+		err := rows.Scan(&user.ID, &user.UserName, &user.Email, &user.CreatedAt, &user.IsActive, &user.DeactivatedAt, &user.Role.Id, &user.Role.Name, &user.Role.Level, &user.Role.Description, &user.Role.Requires2FA)
+		if err != nil {
+			return nil, err
+		}
+		user.RoleID = user.Role.Id
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (s *UserStore) SetRole(ctx context.Context, userId, roleId int64) error {
+	query := `UPDATE users SET role_id=$1 WHERE id=$2`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, query, roleId, userId)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrorNotFound
+	}
+	return nil
+}
+
+// SetActive activates or deactivates a user. Deactivation is recorded in
+// deactivated_at, so it is never mistaken for a signup that was not
+// activated yet, and also revokes the user's refresh tokens so no new
+// access tokens can be minted. Reactivation clears it. The ids of the
+// sessions deactivation ended are returned.
+func (s *UserStore) SetActive(ctx context.Context, userId int64, active bool) ([]string, error) {
+	var sessionIDs []string
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+		UPDATE users SET is_active=$1,
+		activated_at=CASE WHEN $1 THEN COALESCE(activated_at,NOW()) ELSE activated_at END,
+		deactivated_at=CASE WHEN $1 THEN NULL ELSE COALESCE(deactivated_at,NOW()) END
+		WHERE id=$2
+		`
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		res, err := tx.ExecContext(ctx, query, active, userId)
+		if err != nil {
+			return err
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrorNotFound
+		}
+		if active {
+			return nil
+		}
+		sessionIDs, err = revokeUserRefreshTokens(ctx, tx, userId)
+		return err
+	})
+	return sessionIDs, err
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,108 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// WaitlistEntry is someone waiting for an invite. InviteCode is only set on
+// entries returned by Invite.
+type WaitlistEntry struct {
+	ID           int64      `json:"id"`
+	Email        string     `json:"email"`
+	InviteCodeID *int64     `json:"invite_code_id"`
+	InvitedAt    *time.Time `json:"invited_at"`
+	CreatedAt    string     `json:"created_at"`
+	InviteCode   string     `json:"invite_code,omitempty"`
+}
+
+type WaitlistStore struct {
+	db *sql.DB
+}
+
+// Add puts the email on the waitlist. Adding it twice is not an error.
+func (s *WaitlistStore) Add(ctx context.Context, email string) error {
+	query := `INSERT INTO waitlist (email) VALUES ($1) ON CONFLICT (email) DO NOTHING`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, query, email)
+	return err
+}
+
+func (s *WaitlistStore) List(ctx context.Context, wq PaginatedWaitlistQuery) ([]WaitlistEntry, error) {
+	query := `
+	SELECT id,email,invite_code_id,invited_at,created_at FROM waitlist
+	WHERE
+	($3='' OR ($3='pending' AND invited_at IS NULL) OR ($3='invited' AND invited_at IS NOT NULL))
+	ORDER BY id ASC
+	LIMIT $1 OFFSET $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, wq.Limit, wq.Offset, wq.Status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []WaitlistEntry{}
+	for rows.Next() {
+		var e WaitlistEntry
+		if err := rows.Scan(&e.ID, &e.Email, &e.InviteCodeID, &e.InvitedAt, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Invite hands the codes out to the longest waiting entries that have not
+// been invited yet, one code each. Codes left over are not stored.
+func (s *WaitlistStore) Invite(ctx context.Context, codes []*InviteCode) ([]WaitlistEntry, error) {
+	var entries []WaitlistEntry
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		entries = nil
+		query := `
+		SELECT id,email,created_at FROM waitlist
+		WHERE invited_at IS NULL
+		ORDER BY id ASC
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+		`
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		rows, err := tx.QueryContext(ctx, query, len(codes))
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var e WaitlistEntry
+			if err := rows.Scan(&e.ID, &e.Email, &e.CreatedAt); err != nil {
+				rows.Close()
+				return err
+			}
+			entries = append(entries, e)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for i := range entries {
+			code := codes[i]
+			if err := createInviteCode(ctx, tx, code); err != nil {
+				return err
+			}
+			query := `UPDATE waitlist SET invite_code_id=$1,invited_at=NOW() WHERE id=$2 RETURNING invited_at`
+			if err := tx.QueryRowContext(ctx, query, code.ID, entries[i].ID).Scan(&entries[i].InvitedAt); err != nil {
+				return err
+			}
+			entries[i].InviteCodeID = &code.ID
+			entries[i].InviteCode = code.Code
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}